@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"auto-https/internal/acme"
+	"auto-https/internal/config"
+	"auto-https/internal/retry"
+)
+
+func splitNames(s string) []string {
+	var out []string
+	for _, n := range strings.Split(s, ",") {
+		n = strings.TrimSpace(n)
+		if n != "" {
+			out = append(out, n)
+		}
+	}
+	return out
+}
+
+// acmeNames is what the built-in ACME client orders: acme_domains, or the
+// cert_domain whose live directory the certificate source reads, falling
+// back to rr_a.domain.
+func acmeNames(j *config.Job) []string {
+	if len(j.ACMEDomains) > 0 {
+		return j.ACMEDomains
+	}
+	if j.CertDomain != "" {
+		return []string{j.CertDomain}
+	}
+	return []string{j.RRA + "." + j.Domain}
+}
+
+// acmeHTTPClient bounds each ACME request by timeout and, when caFile is
+// set, trusts only the CA in it (e.g. a local Pebble).
+func acmeHTTPClient(caFile string, timeout time.Duration) (*http.Client, error) {
+	if caFile == "" {
+		return &http.Client{Timeout: timeout}, nil
+	}
+	b, err := os.ReadFile(caFile)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(b) {
+		return nil, fmt.Errorf("no certificates in %s", caFile)
+	}
+	return &http.Client{
+		Timeout:   timeout,
+		Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool}},
+	}, nil
+}
+
+// obtainCert orders a certificate for names and stores it under
+// liveDir/<first name>, returning the new key and fullchain paths.
+func obtainCert(opts config.ACME, policy retry.Policy, names []string, solver acme.Solver, liveDir string) (string, string, error) {
+	hc, err := acmeHTTPClient(opts.CA, policy.Timeout)
+	if err != nil {
+		return "", "", err
+	}
+	client := &acme.Client{
+		DirectoryURL:   opts.Directory,
+		AccountKeyPath: opts.AccountKey,
+		Email:          opts.Email,
+		HTTPClient:     hc,
+		Retry:          policy,
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	defer cancel()
+	cert, err := client.Obtain(ctx, names, solver)
+	if err != nil {
+		return "", "", err
+	}
+	return acme.Save(filepath.Join(liveDir, names[0]), cert)
+}
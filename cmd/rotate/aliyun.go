@@ -0,0 +1,698 @@
+package main
+
+import (
+	"context"
+	"crypto/sha1"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"auto-https/internal/aliyun"
+	"auto-https/internal/certs"
+	"auto-https/internal/config"
+)
+
+// aliyunVerifyTimeout is used when a deploy target sets no verify_timeout.
+const aliyunVerifyTimeout = "5m"
+
+// lbPollInterval is how often a switched load balancer listener is checked.
+var lbPollInterval = 5 * time.Second
+
+// aliyunCDNDeployer uploads the certificate to Alibaba Cloud CDN or DCDN
+// domains. Domains already serving it are left alone.
+type aliyunCDNDeployer struct {
+	conf config.Deploy
+	dcdn bool
+
+	cdn     *aliyun.CDN
+	prev    map[string]*aliyun.DomainCert
+	pending []string
+	updated []string
+}
+
+func (a *aliyunCDNDeployer) Name() string { return a.conf.Name }
+
+func (a *aliyunCDNDeployer) domains(j *config.Job) []string {
+	if len(a.conf.Domains) > 0 {
+		return a.conf.Domains
+	}
+	return targetDomains(j)
+}
+
+func (a *aliyunCDNDeployer) client(e *env) (*aliyun.CDN, error) {
+	if err := aliyunCredentials(e); err != nil {
+		return nil, err
+	}
+	return e.aliyunCDN(a.conf.Endpoint, a.dcdn)
+}
+
+func (a *aliyunCDNDeployer) Prepare(ctx context.Context, d *deployment) error {
+	cdn, err := a.client(d.env)
+	if err != nil {
+		return err
+	}
+	a.cdn, a.prev = cdn, map[string]*aliyun.DomainCert{}
+	fingerprint := certs.Fingerprint(d.leaf())
+	for _, domain := range a.domains(d.job) {
+		cur, err := cdn.DomainCert(ctx, domain)
+		if err != nil {
+			return fmt.Errorf("查询%s域名 %s 当前证书失败：%w", cdn, domain, err)
+		}
+		a.prev[domain] = cur
+		if pemFingerprint(cur.PEM) == fingerprint {
+			fmt.Printf("阿里云%s域名已使用当前证书，跳过：%s\n", cdn, domain)
+			continue
+		}
+		a.pending = append(a.pending, domain)
+	}
+	return nil
+}
+
+// Deploy uploads the certificate with the first pending domain. The upload
+// lands in Certificate Management Service, so the other domains are bound to
+// it by ID rather than uploading it again.
+func (a *aliyunCDNDeployer) Deploy(ctx context.Context, d *deployment) error {
+	var casID string
+	for i, domain := range a.pending {
+		cert := aliyun.SSLCert{CASID: casID}
+		if casID == "" {
+			cert = aliyun.SSLCert{
+				Name: uploadName(d),
+				Pub:  string(d.bundle.ChainPEM),
+				Pri:  string(d.bundle.KeyPEM),
+			}
+		}
+		if err := a.cdn.SetCert(ctx, domain, cert); err != nil {
+			return fmt.Errorf("设置%s域名 %s 证书失败：%w", a.cdn, domain, err)
+		}
+		a.updated = append(a.updated, domain)
+		fmt.Printf("已设置阿里云%s域名证书：%s\n", a.cdn, domain)
+		if casID == "" && i < len(a.pending)-1 {
+			id, err := a.uploadedID(ctx, domain, d)
+			if err != nil {
+				return fmt.Errorf("查询%s域名 %s 新证书 ID 失败：%w", a.cdn, domain, err)
+			}
+			casID = id
+		}
+	}
+	return nil
+}
+
+// uploadedID waits until domain reports the certificate just uploaded and
+// returns its ID.
+func (a *aliyunCDNDeployer) uploadedID(ctx context.Context, domain string, d *deployment) (string, error) {
+	timeout, _ := time.ParseDuration(a.verifyTimeout())
+	if timeout <= 0 {
+		timeout, _ = time.ParseDuration(aliyunVerifyTimeout)
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	fingerprint := certs.Fingerprint(d.leaf())
+	for {
+		cur, err := a.cdn.DomainCert(ctx, domain)
+		if err == nil && cur.CertID != "" && pemFingerprint(cur.PEM) == fingerprint {
+			return cur.CertID, nil
+		}
+		if err == nil {
+			err = fmt.Errorf("当前证书 %s", cur.CertName)
+		}
+		select {
+		case <-ctx.Done():
+			return "", err
+		case <-time.After(5 * time.Second):
+		}
+	}
+}
+
+// Verify polls the domain's certificate info until it reports the new
+// certificate with status success.
+func (a *aliyunCDNDeployer) Verify(ctx context.Context, d *deployment) error {
+	timeout, _ := time.ParseDuration(a.verifyTimeout())
+	if timeout <= 0 || len(a.updated) == 0 {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	fingerprint := certs.Fingerprint(d.leaf())
+	for _, domain := range a.updated {
+		fmt.Printf("等待阿里云%s配置生效：%s\n", a.cdn, domain)
+		for {
+			cur, err := a.cdn.DomainCert(ctx, domain)
+			if err == nil && pemFingerprint(cur.PEM) == fingerprint && (cur.Status == "" || cur.Status == "success") {
+				fmt.Printf("已确认阿里云%s域名使用新证书：%s\n", a.cdn, domain)
+				break
+			}
+			if err == nil {
+				err = fmt.Errorf("当前证书 %s，状态 %s", cur.CertName, cur.Status)
+			}
+			select {
+			case <-ctx.Done():
+				return fmt.Errorf("%s 在 %s 内未生效：%w", domain, a.verifyTimeout(), err)
+			case <-time.After(10 * time.Second):
+			}
+		}
+	}
+	return nil
+}
+
+func (a *aliyunCDNDeployer) verifyTimeout() string {
+	if a.conf.VerifyTimeout != "" {
+		return a.conf.VerifyTimeout
+	}
+	return aliyunVerifyTimeout
+}
+
+// Rollback points every updated domain back at its previous certificate,
+// which the service keeps by ID, with its previous certificate type; the
+// free certificate is requested again and HTTPS is turned off again where it
+// was off.
+func (a *aliyunCDNDeployer) Rollback(ctx context.Context, d *deployment) error {
+	var errs []string
+	for _, domain := range a.updated {
+		prev := a.prev[domain]
+		var err error
+		switch {
+		case !prev.Enabled:
+			err = a.cdn.DisableSSL(ctx, domain)
+		case prev.CertType == "free":
+			err = a.cdn.SetCert(ctx, domain, aliyun.SSLCert{Type: prev.CertType})
+		case prev.CertID != "":
+			err = a.cdn.SetCert(ctx, domain, aliyun.SSLCert{CASID: prev.CertID, Type: prev.CertType})
+		default:
+			fmt.Fprintf(os.Stderr, "阿里云%s域名 %s 原证书没有证书 ID，无法回滚\n", a.cdn, domain)
+			continue
+		}
+		if err != nil {
+			errs = append(errs, domain+"："+err.Error())
+			continue
+		}
+		fmt.Printf("已恢复阿里云%s域名原证书：%s %s\n", a.cdn, domain, prev.CertName)
+	}
+	a.updated = nil
+	if len(errs) > 0 {
+		return fmt.Errorf("%s", strings.Join(errs, "；"))
+	}
+	return nil
+}
+
+func (a *aliyunCDNDeployer) Plan(ctx context.Context, d *deployment, p *plan) error {
+	cdn, err := a.client(d.env)
+	if err != nil {
+		return err
+	}
+	uploaded := false
+	for _, domain := range a.domains(d.job) {
+		cur, err := cdn.DomainCert(ctx, domain)
+		if err != nil {
+			return fmt.Errorf("查询%s域名 %s 当前证书失败：%w", cdn, domain, err)
+		}
+		// the configured certificate can only be compared when no renewal runs first
+		if config.On(d.job.QiniuOnly) && pemFingerprint(cur.PEM) == certs.Fingerprint(d.leaf()) {
+			p.step("阿里云%s域名 %s 已使用当前证书，跳过", cdn, domain)
+			continue
+		}
+		if uploaded {
+			p.step("为阿里云%s域名 %s 绑定上面上传的证书（当前证书 %s，HTTPS %s）", cdn, domain, cur.CertName, onOff(cur.Enabled))
+		} else {
+			p.step("为阿里云%s域名 %s 上传证书 %s（当前证书 %s，HTTPS %s）", cdn, domain, uploadName(d), cur.CertName, onOff(cur.Enabled))
+			uploaded = true
+		}
+		if t, _ := time.ParseDuration(a.verifyTimeout()); t > 0 {
+			p.step("等待 %s 配置生效并确认证书（超时 %s）", domain, a.verifyTimeout())
+		}
+	}
+	return nil
+}
+
+// casDeployer uploads the certificate to Certificate Management Service and
+// records its CertId, reusing an upload with the same serial number.
+type casDeployer struct {
+	conf config.Deploy
+
+	cas      *aliyun.CAS
+	cn       string
+	existing []aliyun.CASCert
+	certID   string
+	uploaded bool
+}
+
+func (c *casDeployer) Name() string { return c.conf.Name }
+
+func (c *casDeployer) Prepare(ctx context.Context, d *deployment) error {
+	if err := aliyunCredentials(d.env); err != nil {
+		return err
+	}
+	cas, err := d.env.aliyunCAS(c.conf.Endpoint)
+	if err != nil {
+		return err
+	}
+	c.cas, c.cn = cas, commonName(d)
+	if c.existing, err = cas.List(ctx, c.cn); err != nil {
+		return fmt.Errorf("查询阿里云证书服务证书列表失败：%w", err)
+	}
+	return nil
+}
+
+func (c *casDeployer) Deploy(ctx context.Context, d *deployment) error {
+	if id := c.reuseID(d); id != "" {
+		fmt.Println("阿里云证书服务已存在相同证书，直接复用，CertId:", id)
+		c.certID = id
+	} else {
+		id, err := c.cas.Upload(ctx, uploadName(d), string(d.bundle.ChainPEM), string(d.bundle.KeyPEM))
+		if err != nil {
+			return fmt.Errorf("上传阿里云证书服务失败：%w", err)
+		}
+		fmt.Println("阿里云证书服务上传成功，CertId:", id)
+		c.certID, c.uploaded = id, true
+	}
+	d.run.CASCertID, d.casRegion = c.certID, c.cas.Region()
+	return nil
+}
+
+func (c *casDeployer) reuseID(d *deployment) string {
+	for _, e := range c.existing {
+		if e.CommonName == c.cn && e.SameSerial(d.leaf().SerialNumber) {
+			return e.ID
+		}
+	}
+	return ""
+}
+
+// Verify reads the stored certificate back and compares it with the leaf.
+func (c *casDeployer) Verify(ctx context.Context, d *deployment) error {
+	pem, err := c.cas.Get(ctx, c.certID)
+	if err != nil {
+		return fmt.Errorf("读取阿里云证书服务证书 %s 失败：%w", c.certID, err)
+	}
+	if pemFingerprint(pem) != certs.Fingerprint(d.leaf()) {
+		return fmt.Errorf("阿里云证书服务证书 %s 与本地证书不一致", c.certID)
+	}
+	return nil
+}
+
+// Rollback deletes the certificate this run uploaded; a reused one stays.
+func (c *casDeployer) Rollback(ctx context.Context, d *deployment) error {
+	if !c.uploaded {
+		return nil
+	}
+	if err := c.cas.Delete(ctx, c.certID); err != nil {
+		return fmt.Errorf("删除阿里云证书服务证书 %s 失败：%w", c.certID, err)
+	}
+	fmt.Println("已删除本次上传的阿里云证书服务证书：", c.certID)
+	c.uploaded = false
+	d.run.CASCertID = ""
+	return nil
+}
+
+// Finish deletes older uploads of the same common name beyond prune_keep.
+func (c *casDeployer) Finish(ctx context.Context, d *deployment) error {
+	if c.conf.PruneKeep <= 0 {
+		return nil
+	}
+	// the deployed certificate counts towards keep and is never deleted
+	keep := c.conf.PruneKeep - 1
+	var errs []string
+	for _, e := range pruneCAS(c.existing, c.cn, c.certID, keep) {
+		if err := c.cas.Delete(ctx, e.ID); err != nil {
+			errs = append(errs, e.ID+"："+err.Error())
+			continue
+		}
+		fmt.Println("已删除阿里云证书服务旧证书：", e.ID, e.Name, e.EndDate)
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("删除阿里云证书服务旧证书失败：%s", strings.Join(errs, "；"))
+	}
+	return nil
+}
+
+func (c *casDeployer) Plan(ctx context.Context, d *deployment, p *plan) error {
+	if err := c.Prepare(ctx, d); err != nil {
+		return err
+	}
+	if id := c.reuseID(d); id != "" {
+		p.step("阿里云证书服务已存在相同证书 %s，直接复用", id)
+		c.certID = id
+	} else {
+		p.step("上传证书到阿里云证书服务：名称 %s，通用名称 %s", uploadName(d), c.cn)
+	}
+	// later targets of the plan refer to the certificate by this ID
+	d.run.CASCertID, d.casRegion = c.certID, c.cas.Region()
+	if d.run.CASCertID == "" {
+		d.run.CASCertID = "<上传返回的CertId>"
+	}
+	if c.conf.PruneKeep > 0 {
+		keep := c.conf.PruneKeep - 1
+		p.step("全部目标部署成功后，清理通用名称为 %s 的旧证书，保留最新 %d 个：", c.cn, c.conf.PruneKeep)
+		for _, e := range pruneCAS(c.existing, c.cn, c.certID, keep) {
+			fmt.Printf("     删除 %s %s（到期 %s）\n", e.ID, e.Name, e.EndDate)
+		}
+	}
+	return nil
+}
+
+// pruneCAS returns the uploads of cn, newest first in list, that fall outside
+// the newest keep; current is never included.
+func pruneCAS(list []aliyun.CASCert, cn, current string, keep int) []aliyun.CASCert {
+	var drop []aliyun.CASCert
+	n := 0
+	for _, e := range list {
+		if e.CommonName != cn || e.ID == current {
+			continue
+		}
+		if n++; n > keep {
+			drop = append(drop, e)
+		}
+	}
+	return drop
+}
+
+// commonName is the leaf's subject common name, or its first SAN.
+func commonName(d *deployment) string {
+	leaf := d.leaf()
+	if leaf.Subject.CommonName != "" {
+		return leaf.Subject.CommonName
+	}
+	if len(leaf.DNSNames) > 0 {
+		return leaf.DNSNames[0]
+	}
+	return targetDomains(d.job)[0]
+}
+
+func aliyunCredentials(e *env) error {
+	if e.aliyunAK == "" || e.aliyunSK == "" {
+		return fmt.Errorf("缺少阿里云凭证：请设置 ALICLOUD_ACCESS_KEY_ID 和 ALICLOUD_ACCESS_KEY_SECRET")
+	}
+	return nil
+}
+
+// pemFingerprint is the fingerprint of the leaf in a PEM chain, or "" when
+// there is none.
+func pemFingerprint(pem string) string {
+	chain, err := certs.ParseChain([]byte(pem))
+	if err != nil || len(chain) == 0 {
+		return ""
+	}
+	return certs.Fingerprint(chain[0])
+}
+
+// uploadName names the certificate when uploaded to a cloud provider: the
+// local name, the issue date and a serial prefix, which keeps renewals apart.
+func uploadName(d *deployment) string {
+	leaf := d.leaf()
+	name := strings.NewReplacer("*", "_", ".", "_").Replace(d.files.Name)
+	serial := leaf.SerialNumber.Text(16)
+	if len(serial) > 8 {
+		serial = serial[:8]
+	}
+	return fmt.Sprintf("%s-%s-%s", name, leaf.NotBefore.Format("20060102"), serial)
+}
+
+func onOff(b bool) string {
+	if b {
+		return "开启"
+	}
+	return "关闭"
+}
+
+// lbDeployer switches Alibaba Cloud SLB or ALB HTTPS listeners to the new
+// certificate. SLB certificates are uploaded to SLB itself; ALB takes a
+// Certificate Management Service certificate, from an earlier aliyun-cas
+// target or uploaded here.
+type lbDeployer struct {
+	conf config.Deploy
+	alb  bool
+
+	slb       *aliyun.SLB
+	albc      *aliyun.ALB
+	cas       *casDeployer
+	listeners []*lbListener
+	certID    string
+	uploaded  bool
+}
+
+type lbListener struct {
+	spec string
+	lb   string
+	port int
+	// id is the ALB listener ID.
+	id      string
+	prev    string
+	updated bool
+}
+
+// parseListener splits "<load balancer ID>:<port>".
+func parseListener(s string) (lb string, port int, err error) {
+	lb, p, ok := strings.Cut(s, ":")
+	if !ok || lb == "" {
+		return "", 0, fmt.Errorf("missing port in %q", s)
+	}
+	port, err = strconv.Atoi(p)
+	if err != nil || port <= 0 || port > 65535 {
+		return "", 0, fmt.Errorf("bad port in %q", s)
+	}
+	return lb, port, nil
+}
+
+func (l *lbDeployer) Name() string { return l.conf.Name }
+
+func (l *lbDeployer) product() string {
+	if l.alb {
+		return "ALB"
+	}
+	return "SLB"
+}
+
+func (l *lbDeployer) region() string {
+	if l.conf.Region != "" {
+		return l.conf.Region
+	}
+	return aliyun.DefaultRegion
+}
+
+func (l *lbDeployer) Prepare(ctx context.Context, d *deployment) error {
+	if err := aliyunCredentials(d.env); err != nil {
+		return err
+	}
+	var err error
+	if l.alb {
+		l.albc, err = d.env.aliyunALB(l.conf.Region, l.conf.Endpoint)
+	} else {
+		l.slb, err = d.env.aliyunSLB(l.conf.Region, l.conf.Endpoint)
+	}
+	if err != nil {
+		return err
+	}
+	l.listeners = nil
+	for _, spec := range l.conf.Listeners {
+		lb, port, _ := parseListener(spec)
+		ln := &lbListener{spec: spec, lb: lb, port: port}
+		if l.alb {
+			cur, err := l.albc.FindListener(ctx, lb, port)
+			if err != nil {
+				return fmt.Errorf("查询 ALB 监听 %s 失败：%w", spec, err)
+			}
+			ln.id, ln.prev = cur.ID, cur.CertID
+		} else if ln.prev, err = l.slb.ListenerCert(ctx, lb, port); err != nil {
+			return fmt.Errorf("查询 SLB 监听 %s 失败：%w", spec, err)
+		}
+		l.listeners = append(l.listeners, ln)
+	}
+	// an aliyun-cas target, which validateJob puts before this one, supplies
+	// the certificate ID
+	if l.alb && !hasDeploy(d.job, config.DeployAliyunCAS) {
+		l.cas = &casDeployer{conf: config.Deploy{Name: l.conf.Name}}
+		return l.cas.Prepare(ctx, d)
+	}
+	return nil
+}
+
+func hasDeploy(j *config.Job, typ string) bool {
+	for _, d := range j.Deploy {
+		if d.Type == typ {
+			return true
+		}
+	}
+	return false
+}
+
+func (l *lbDeployer) Deploy(ctx context.Context, d *deployment) error {
+	if err := l.certificate(ctx, d); err != nil {
+		return err
+	}
+	for _, ln := range l.listeners {
+		if ln.prev == l.certID {
+			fmt.Printf("%s 监听 %s 已使用当前证书，跳过\n", l.product(), ln.spec)
+			continue
+		}
+		var err error
+		if l.alb {
+			err = l.albc.SetListenerCert(ctx, ln.id, l.certID)
+		} else {
+			err = l.slb.SetListenerCert(ctx, ln.lb, ln.port, l.certID)
+		}
+		if err != nil {
+			return fmt.Errorf("更新 %s 监听 %s 证书失败：%w", l.product(), ln.spec, err)
+		}
+		ln.updated = true
+		fmt.Printf("已将 %s 监听 %s 的证书从 %s 切换为 %s\n", l.product(), ln.spec, ln.prev, l.certID)
+	}
+	return nil
+}
+
+// certificate sets l.certID, uploading the certificate unless the product
+// already holds it.
+func (l *lbDeployer) certificate(ctx context.Context, d *deployment) error {
+	if l.alb {
+		if l.cas != nil {
+			if err := l.cas.Deploy(ctx, d); err != nil {
+				return err
+			}
+		}
+		l.certID = aliyun.CASCertID(d.run.CASCertID, d.casRegion)
+		return nil
+	}
+	existing, err := l.slb.ServerCertificates(ctx)
+	if err != nil {
+		return fmt.Errorf("查询 SLB 证书列表失败：%w", err)
+	}
+	fingerprint := sha1Fingerprint(d.leaf())
+	for _, c := range existing {
+		if strings.EqualFold(c.Fingerprint, fingerprint) {
+			fmt.Println("SLB 已存在相同证书，直接复用：", c.ID)
+			l.certID = c.ID
+			return nil
+		}
+	}
+	id, err := l.slb.UploadServerCertificate(ctx, uploadName(d), string(d.bundle.ChainPEM), string(d.bundle.KeyPEM))
+	if err != nil {
+		return fmt.Errorf("上传 SLB 证书失败：%w", err)
+	}
+	fmt.Println("SLB 证书上传成功：", id)
+	l.certID, l.uploaded = id, true
+	return nil
+}
+
+// Verify waits until every switched listener reports the new certificate;
+// ALB applies changes asynchronously and must be Running again.
+func (l *lbDeployer) Verify(ctx context.Context, d *deployment) error {
+	verifyTimeout := l.conf.VerifyTimeout
+	if verifyTimeout == "" {
+		verifyTimeout = aliyunVerifyTimeout
+	}
+	timeout, _ := time.ParseDuration(verifyTimeout)
+	if timeout <= 0 {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	for _, ln := range l.listeners {
+		if !ln.updated {
+			continue
+		}
+		for {
+			cert, status, err := l.current(ctx, ln)
+			if err == nil && cert == l.certID && (status == "" || status == "Running") {
+				fmt.Printf("已确认 %s 监听 %s 使用新证书\n", l.product(), ln.spec)
+				break
+			}
+			if err == nil {
+				err = fmt.Errorf("当前证书 %s，状态 %s", cert, status)
+			}
+			select {
+			case <-ctx.Done():
+				return fmt.Errorf("%s 监听 %s 在 %s 内未生效：%w", l.product(), ln.spec, verifyTimeout, err)
+			case <-time.After(lbPollInterval):
+			}
+		}
+	}
+	return nil
+}
+
+func (l *lbDeployer) current(ctx context.Context, ln *lbListener) (cert, status string, err error) {
+	if l.alb {
+		cur, err := l.albc.Listener(ctx, ln.id)
+		if err != nil {
+			return "", "", err
+		}
+		return cur.CertID, cur.Status, nil
+	}
+	cert, err = l.slb.ListenerCert(ctx, ln.lb, ln.port)
+	return cert, "", err
+}
+
+// Rollback switches updated listeners back to their previous certificate
+// ID and removes a certificate uploaded by this run.
+func (l *lbDeployer) Rollback(ctx context.Context, d *deployment) error {
+	var errs []string
+	for _, ln := range l.listeners {
+		if !ln.updated {
+			continue
+		}
+		if ln.prev == "" {
+			fmt.Fprintf(os.Stderr, "%s 监听 %s 原先没有证书，无法回滚\n", l.product(), ln.spec)
+			continue
+		}
+		var err error
+		if l.alb {
+			err = l.albc.SetListenerCert(ctx, ln.id, ln.prev)
+		} else {
+			err = l.slb.SetListenerCert(ctx, ln.lb, ln.port, ln.prev)
+		}
+		if err != nil {
+			errs = append(errs, ln.spec+"："+err.Error())
+			continue
+		}
+		ln.updated = false
+		fmt.Printf("已恢复 %s 监听 %s 原证书：%s\n", l.product(), ln.spec, ln.prev)
+	}
+	if len(errs) > 0 {
+		// the new certificate is still in use
+		return fmt.Errorf("%s", strings.Join(errs, "；"))
+	}
+	switch {
+	case l.cas != nil:
+		return l.cas.Rollback(ctx, d)
+	case l.uploaded:
+		if err := l.slb.DeleteServerCertificate(ctx, l.certID); err != nil {
+			return fmt.Errorf("删除本次上传的 SLB 证书 %s 失败：%w", l.certID, err)
+		}
+		l.uploaded = false
+		fmt.Println("已删除本次上传的 SLB 证书：", l.certID)
+	}
+	return nil
+}
+
+func (l *lbDeployer) Plan(ctx context.Context, d *deployment, p *plan) error {
+	if err := l.Prepare(ctx, d); err != nil {
+		return err
+	}
+	certID := "<新证书ID>"
+	if l.alb {
+		if l.cas != nil {
+			if err := l.cas.Plan(ctx, d, p); err != nil {
+				return err
+			}
+		}
+		certID = aliyun.CASCertID(d.run.CASCertID, d.casRegion)
+	} else {
+		p.step("上传证书到 SLB（%s）：名称 %s，已存在相同指纹的证书时复用", l.region(), uploadName(d))
+	}
+	for _, ln := range l.listeners {
+		p.step("将 %s 监听 %s 的证书从 %s 切换为 %s", l.product(), ln.spec, ln.prev, certID)
+	}
+	p.step("失败时把以上监听切换回原证书 ID")
+	return nil
+}
+
+// sha1Fingerprint is the colon separated SHA-1 fingerprint SLB lists.
+func sha1Fingerprint(cert *x509.Certificate) string {
+	sum := sha1.Sum(cert.Raw)
+	parts := make([]string, len(sum))
+	for i, b := range sum {
+		parts[i] = fmt.Sprintf("%02x", b)
+	}
+	return strings.Join(parts, ":")
+}
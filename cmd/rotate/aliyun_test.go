@@ -0,0 +1,361 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"auto-https/internal/certs"
+	"auto-https/internal/config"
+	"auto-https/internal/state"
+)
+
+// rpcCall is one request received by fakeAliyun.
+type rpcCall struct {
+	Action string
+	Params url.Values
+}
+
+// fakeAliyun serves Alibaba Cloud RPC style actions from handlers keyed by
+// action name and records every call. A handler returning an error answers
+// with that error code.
+func fakeAliyun(t *testing.T, handlers map[string]func(q url.Values) any) (string, *[]rpcCall) {
+	var (
+		mu    sync.Mutex
+		calls []rpcCall
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			t.Errorf("parse form: %v", err)
+		}
+		action := r.Header.Get("x-acs-action")
+		mu.Lock()
+		calls = append(calls, rpcCall{Action: action, Params: r.Form})
+		mu.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		h, ok := handlers[action]
+		if !ok {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"Code": "InvalidAction.NotFound", "Message": action})
+			return
+		}
+		resp := h(r.Form)
+		if err, ok := resp.(error); ok {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"Code": err.Error(), "Message": err.Error()})
+			return
+		}
+		json.NewEncoder(w).Encode(resp)
+	}))
+	t.Cleanup(srv.Close)
+	return srv.URL, &calls
+}
+
+// testDeployment is a deployment of a freshly issued certificate for names
+// with Alibaba Cloud credentials set.
+func testDeployment(t *testing.T, names ...string) *deployment {
+	t.Helper()
+	dir := t.TempDir()
+	newTestCA(t).issue(t, dir, 90*24*time.Hour, names...)
+	files := certs.Files{Name: names[0], KeyPath: filepath.Join(dir, "privkey.pem"), ChainPath: filepath.Join(dir, "fullchain.pem")}
+	bundle, err := certs.LoadBundle(files.KeyPath, files.ChainPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &deployment{
+		job:    &config.Job{Name: names[0], CertDomain: names[0]},
+		env:    &env{aliyunAK: "ak", aliyunSK: "secret"},
+		files:  files,
+		bundle: bundle,
+		run:    &state.Run{},
+	}
+}
+
+func TestAliyunCDNRollbackByCertType(t *testing.T) {
+	type domainCert struct {
+		on  bool
+		id  string
+		typ string
+		pem string
+	}
+	var mu sync.Mutex
+	domains := map[string]*domainCert{
+		"free.example.com":   {on: true, typ: "free"},
+		"upload.example.com": {on: true, id: "11", typ: "upload"},
+		"cas.example.com":    {on: true, id: "12", typ: "cas"},
+		"off.example.com":    {},
+	}
+	endpoint, calls := fakeAliyun(t, map[string]func(url.Values) any{
+		"DescribeDomainCertificateInfo": func(q url.Values) any {
+			mu.Lock()
+			defer mu.Unlock()
+			dc := domains[q.Get("DomainName")]
+			status := "off"
+			if dc.on {
+				status = "on"
+			}
+			return map[string]any{"CertInfos": map[string]any{"CertInfo": []map[string]any{{
+				"DomainName":              q.Get("DomainName"),
+				"CertId":                  dc.id,
+				"CertType":                dc.typ,
+				"Status":                  "success",
+				"ServerCertificateStatus": status,
+				"ServerCertificate":       dc.pem,
+			}}}}
+		},
+		"SetCdnDomainSSLCertificate": func(q url.Values) any {
+			mu.Lock()
+			defer mu.Unlock()
+			dc := domains[q.Get("DomainName")]
+			*dc = domainCert{on: q.Get("SSLProtocol") == "on", typ: q.Get("CertType"), id: q.Get("CertId"), pem: q.Get("SSLPub")}
+			if dc.typ == "upload" && dc.pem != "" {
+				dc.id = "100"
+			}
+			return map[string]string{"RequestId": "r"}
+		},
+	})
+
+	d := testDeployment(t, "example.com", "*.example.com")
+	a := &aliyunCDNDeployer{conf: config.Deploy{
+		Name:          "cdn",
+		Endpoint:      endpoint,
+		VerifyTimeout: "0",
+		Domains:       []string{"free.example.com", "upload.example.com", "cas.example.com", "off.example.com"},
+	}}
+	ctx := context.Background()
+	if err := a.Prepare(ctx, d); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.Deploy(ctx, d); err != nil {
+		t.Fatal(err)
+	}
+	for name, dc := range domains {
+		if !dc.on || dc.id != "100" {
+			t.Fatalf("after Deploy %s = %+v, want the upload bound", name, *dc)
+		}
+	}
+	deployed := len(*calls)
+	if err := a.Rollback(ctx, d); err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]map[string]string{
+		"free.example.com":   {"SSLProtocol": "on", "CertType": "free", "CertId": ""},
+		"upload.example.com": {"SSLProtocol": "on", "CertType": "upload", "CertId": "11"},
+		"cas.example.com":    {"SSLProtocol": "on", "CertType": "cas", "CertId": "12"},
+		"off.example.com":    {"SSLProtocol": "off", "CertType": "", "CertId": ""},
+	}
+	rollback := (*calls)[deployed:]
+	if len(rollback) != len(want) {
+		t.Fatalf("rollback made %d calls, want %d: %+v", len(rollback), len(want), rollback)
+	}
+	for _, c := range rollback {
+		w := want[c.Params.Get("DomainName")]
+		if c.Action != "SetCdnDomainSSLCertificate" || w == nil {
+			t.Errorf("unexpected rollback call %+v", c)
+			continue
+		}
+		for k, v := range w {
+			if got := c.Params.Get(k); got != v {
+				t.Errorf("%s: %s = %q, want %q", c.Params.Get("DomainName"), k, got, v)
+			}
+		}
+		if c.Params.Get("SSLPri") != "" {
+			t.Errorf("%s: rollback sent a private key", c.Params.Get("DomainName"))
+		}
+	}
+}
+
+// fakeSLB is the listener and certificate state behind a fake SLB endpoint.
+type fakeSLB struct {
+	mu        sync.Mutex
+	certs     []map[string]string
+	listeners map[string]string
+	// failSet makes switching the listener of this load balancer fail
+	failSet string
+}
+
+func (f *fakeSLB) handlers() map[string]func(url.Values) any {
+	return map[string]func(url.Values) any{
+		"DescribeServerCertificates": func(q url.Values) any {
+			f.mu.Lock()
+			defer f.mu.Unlock()
+			return map[string]any{"ServerCertificates": map[string]any{"ServerCertificate": f.certs}}
+		},
+		"UploadServerCertificate": func(q url.Values) any {
+			f.mu.Lock()
+			defer f.mu.Unlock()
+			f.certs = append(f.certs, map[string]string{"ServerCertificateId": "uploaded", "ServerCertificateName": q.Get("ServerCertificateName")})
+			return map[string]string{"ServerCertificateId": "uploaded"}
+		},
+		"DeleteServerCertificate": func(q url.Values) any {
+			return map[string]string{"RequestId": "r"}
+		},
+		"DescribeLoadBalancerHTTPSListenerAttribute": func(q url.Values) any {
+			f.mu.Lock()
+			defer f.mu.Unlock()
+			return map[string]string{"ServerCertificateId": f.listeners[q.Get("LoadBalancerId")+":"+q.Get("ListenerPort")]}
+		},
+		"SetLoadBalancerHTTPSListenerAttribute": func(q url.Values) any {
+			f.mu.Lock()
+			defer f.mu.Unlock()
+			if q.Get("LoadBalancerId") == f.failSet {
+				return errors.New("IncorrectStatus.Listener")
+			}
+			f.listeners[q.Get("LoadBalancerId")+":"+q.Get("ListenerPort")] = q.Get("ServerCertificateId")
+			return map[string]string{"RequestId": "r"}
+		},
+	}
+}
+
+// actions lists the actions of calls, skipping the read-only Describe ones.
+func actions(calls []rpcCall) []string {
+	var out []string
+	for _, c := range calls {
+		if !strings.HasPrefix(c.Action, "Describe") && !strings.HasPrefix(c.Action, "Get") && !strings.HasPrefix(c.Action, "List") {
+			out = append(out, c.Action)
+		}
+	}
+	return out
+}
+
+func TestSLBReusesCertificateByFingerprint(t *testing.T) {
+	d := testDeployment(t, "www.example.com")
+	f := &fakeSLB{
+		certs: []map[string]string{
+			{"ServerCertificateId": "other", "Fingerprint": "00:11"},
+			{"ServerCertificateId": "same", "Fingerprint": strings.ToUpper(sha1Fingerprint(d.leaf()))},
+		},
+		listeners: map[string]string{"lb-1:443": "old"},
+	}
+	endpoint, calls := fakeAliyun(t, f.handlers())
+	l := &lbDeployer{conf: config.Deploy{Name: "slb", Endpoint: endpoint, Listeners: []string{"lb-1:443"}}}
+	if err := deployAll(context.Background(), d, []Deployer{l}); err != nil {
+		t.Fatal(err)
+	}
+	if got := actions(*calls); !slices.Equal(got, []string{"SetLoadBalancerHTTPSListenerAttribute"}) {
+		t.Errorf("calls %v, want only the listener switch", got)
+	}
+	if f.listeners["lb-1:443"] != "same" {
+		t.Errorf("listener certificate %s, want the existing upload", f.listeners["lb-1:443"])
+	}
+}
+
+func TestSLBRollbackWhenSecondListenerFails(t *testing.T) {
+	d := testDeployment(t, "www.example.com")
+	f := &fakeSLB{
+		listeners: map[string]string{"lb-1:443": "old1", "lb-2:443": "old2", "lb-3:443": "old3"},
+		failSet:   "lb-2",
+	}
+	endpoint, calls := fakeAliyun(t, f.handlers())
+	l := &lbDeployer{conf: config.Deploy{Name: "slb", Endpoint: endpoint, Listeners: []string{"lb-1:443", "lb-2:443", "lb-3:443"}}}
+	err := deployAll(context.Background(), d, []Deployer{l})
+	if err == nil || !strings.Contains(err.Error(), "lb-2:443") {
+		t.Fatalf("deployAll error = %v, want the lb-2 failure", err)
+	}
+	want := []string{
+		"UploadServerCertificate",
+		"SetLoadBalancerHTTPSListenerAttribute", // lb-1 switched
+		"SetLoadBalancerHTTPSListenerAttribute", // lb-2 fails
+		"SetLoadBalancerHTTPSListenerAttribute", // lb-1 restored
+		"DeleteServerCertificate",
+	}
+	if got := actions(*calls); !slices.Equal(got, want) {
+		t.Errorf("calls\n got %v\nwant %v", got, want)
+	}
+	for lb, id := range map[string]string{"lb-1:443": "old1", "lb-2:443": "old2", "lb-3:443": "old3"} {
+		if f.listeners[lb] != id {
+			t.Errorf("%s certificate %s, want %s", lb, f.listeners[lb], id)
+		}
+	}
+	if last := (*calls)[len(*calls)-1]; last.Params.Get("ServerCertificateId") != "uploaded" {
+		t.Errorf("deleted %s, want the upload of this run", last.Params.Get("ServerCertificateId"))
+	}
+}
+
+func TestALBSwitchesAndWaitsForRunning(t *testing.T) {
+	defer func(d time.Duration) { lbPollInterval = d }(lbPollInterval)
+	lbPollInterval = time.Millisecond
+
+	type listener struct {
+		cert string
+		// pending is the number of reads left before an update is applied
+		pending int
+	}
+	var mu sync.Mutex
+	listeners := map[string]*listener{"lsn-1": {cert: "1-cn-hangzhou"}, "lsn-2": {cert: "2-cn-hangzhou"}}
+	endpoint, calls := fakeAliyun(t, map[string]func(url.Values) any{
+		"ListListeners": func(q url.Values) any {
+			id := map[string]string{"alb-1": "lsn-1", "alb-2": "lsn-2"}[q.Get("LoadBalancerIds.1")]
+			return map[string]any{"Listeners": []map[string]any{
+				{"ListenerId": "lsn-8443", "ListenerPort": 8443, "ListenerProtocol": "HTTPS"},
+				{"ListenerId": id, "ListenerPort": 443, "ListenerProtocol": "HTTPS"},
+			}}
+		},
+		"GetListenerAttribute": func(q url.Values) any {
+			mu.Lock()
+			defer mu.Unlock()
+			l := listeners[q.Get("ListenerId")]
+			status := "Running"
+			if l.pending > 0 {
+				l.pending--
+				status = "Configuring"
+			}
+			return map[string]any{"ListenerStatus": status, "Certificates": []map[string]string{{"CertificateId": l.cert}}}
+		},
+		"UpdateListenerAttribute": func(q url.Values) any {
+			mu.Lock()
+			defer mu.Unlock()
+			l := listeners[q.Get("ListenerId")]
+			l.cert, l.pending = q.Get("Certificates.1.CertificateId"), 3
+			return map[string]string{"RequestId": "r"}
+		},
+	})
+
+	d := testDeployment(t, "www.example.com")
+	// an aliyun-cas target ran first and uploaded to Shanghai
+	d.job.Deploy = []config.Deploy{{Type: config.DeployAliyunCAS}, {Type: config.DeployAliyunALB}}
+	d.run.CASCertID, d.casRegion = "777", "cn-shanghai"
+	l := &lbDeployer{alb: true, conf: config.Deploy{Name: "alb", Endpoint: endpoint, Listeners: []string{"alb-1:443", "alb-2:443"}}}
+	ctx := context.Background()
+	if err := l.Prepare(ctx, d); err != nil {
+		t.Fatal(err)
+	}
+	if err := l.Deploy(ctx, d); err != nil {
+		t.Fatal(err)
+	}
+	if err := l.Verify(ctx, d); err != nil {
+		t.Fatal(err)
+	}
+	var updates []string
+	for _, c := range *calls {
+		if c.Action == "UpdateListenerAttribute" {
+			updates = append(updates, c.Params.Get("ListenerId")+"="+c.Params.Get("Certificates.1.CertificateId"))
+		}
+	}
+	if want := []string{"lsn-1=777-cn-shanghai", "lsn-2=777-cn-shanghai"}; !slices.Equal(updates, want) {
+		t.Errorf("updates %v, want %v", updates, want)
+	}
+	for id, l := range listeners {
+		if l.pending != 0 {
+			t.Errorf("%s: Verify returned before the listener was Running again", id)
+		}
+	}
+
+	// rollback puts the previous certificate IDs back
+	if err := l.Rollback(ctx, d); err != nil {
+		t.Fatal(err)
+	}
+	if listeners["lsn-1"].cert != "1-cn-hangzhou" || listeners["lsn-2"].cert != "2-cn-hangzhou" {
+		t.Errorf("after Rollback: lsn-1 %s, lsn-2 %s", listeners["lsn-1"].cert, listeners["lsn-2"].cert)
+	}
+}
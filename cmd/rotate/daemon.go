@@ -0,0 +1,204 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"os"
+	"runtime/debug"
+	"sort"
+	"sync"
+	"time"
+
+	"auto-https/internal/config"
+	"auto-https/internal/dns"
+	"auto-https/internal/qiniu"
+	"auto-https/internal/state"
+)
+
+// scheduleEntry is one job's slot in the daemon schedule, also served as JSON.
+type scheduleEntry struct {
+	Job        string     `json:"job"`
+	NextRun    time.Time  `json:"next_run"`
+	LastRun    *time.Time `json:"last_run,omitempty"`
+	LastResult string     `json:"last_result,omitempty"`
+	Running    bool       `json:"running"`
+}
+
+type scheduler struct {
+	mu       sync.Mutex
+	entries  []*scheduleEntry
+	interval time.Duration
+	jitter   time.Duration
+}
+
+func (s *scheduler) next(from time.Time) time.Time {
+	t := from.Add(s.interval)
+	if s.jitter > 0 {
+		t = t.Add(time.Duration(rand.Int63n(int64(s.jitter))))
+	}
+	return t
+}
+
+func (s *scheduler) snapshot() []scheduleEntry {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := make([]scheduleEntry, 0, len(s.entries))
+	for _, e := range s.entries {
+		out = append(out, *e)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].NextRun.Before(out[j].NextRun) })
+	return out
+}
+
+func (s *scheduler) printSchedule() {
+	fmt.Println("==== 计划 ====")
+	for _, e := range s.snapshot() {
+		last := "从未执行"
+		if e.LastRun != nil {
+			last = "上次执行 " + e.LastRun.Local().Format("2006-01-02 15:04:05") + " " + e.LastResult
+		}
+		fmt.Printf("%-30s 下次执行 %s，%s\n", e.Job, e.NextRun.Local().Format("2006-01-02 15:04:05"), last)
+	}
+}
+
+// runResult describes a recorded run the way the daemon reports results.
+func runResult(r *state.Run) string {
+	if r.Outcome == state.OutcomeFailed {
+		return "失败：" + r.Error
+	}
+	return "成功"
+}
+
+// runScheduled runs one job for the daemon. A panic fails that job instead
+// of stopping the schedule for every job.
+func runScheduled(j *config.Job, e *env) (err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			fmt.Fprintf(os.Stderr, "任务 %s 异常退出：%v\n%s", j.Name, p, debug.Stack())
+			err = fmt.Errorf("panic: %v", p)
+		}
+	}()
+	return runJob(j, e)
+}
+
+func (s *scheduler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s.snapshot())
+}
+
+// runDaemon implements `rotate-cert daemon`: jobs from the config file are
+// checked every interval (plus random jitter) and renewed/deployed when due.
+func runDaemon(args []string) int {
+	fs := flag.NewFlagSet("daemon", flag.ExitOnError)
+	var (
+		path     string
+		e        env
+		interval string
+		jitter   string
+		listen   string
+	)
+	fs.StringVar(&path, "config", "./rotate.toml", "任务配置文件路径（TOML）")
+	fs.StringVar(&interval, "interval", "", "检查间隔，例如 12h（默认取配置 [daemon] 或 12h）")
+	fs.StringVar(&jitter, "jitter", "", "每次检查附加的随机延迟上限，例如 30m（默认取配置 [daemon] 或 30m）")
+	fs.StringVar(&listen, "listen", "", "计划查询地址，例如 127.0.0.1:8625，GET /schedule 返回 JSON（可选）")
+	fs.StringVar(&e.qiniuAK, "qiniu-ak", os.Getenv("QINIU_ACCESS_KEY"), "七牛AK（可用环境变量QINIU_ACCESS_KEY）")
+	fs.StringVar(&e.qiniuSK, "qiniu-sk", os.Getenv("QINIU_SECRET_KEY"), "七牛SK（可用环境变量QINIU_SECRET_KEY）")
+	fs.StringVar(&e.qiniuToken, "qiniu-token", qiniu.TokenAuto, "七牛鉴权模式：auto|v1|v2")
+	fs.BoolVar(&e.verbose, "verbose", false, "打印详细过程，例如每个候选证书被选用或排除的原因")
+	fs.IntVar(&e.pageSize, "page-size", dns.AliyunMaxPageSize, "查询解析记录时每页条数，最大500")
+	addRetryFlags(fs, &e)
+	fs.Parse(args)
+
+	cfg, err := loadConfig(path, &e)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	pick := func(flagVal, cfgVal, def string) string {
+		if flagVal != "" {
+			return flagVal
+		}
+		if cfgVal != "" {
+			return cfgVal
+		}
+		return def
+	}
+	s := &scheduler{}
+	if s.interval, err = time.ParseDuration(pick(interval, cfg.Daemon.Interval, "12h")); err != nil || s.interval <= 0 {
+		fmt.Fprintln(os.Stderr, "检查间隔格式错误：", pick(interval, cfg.Daemon.Interval, "12h"))
+		return 2
+	}
+	if s.jitter, err = time.ParseDuration(pick(jitter, cfg.Daemon.Jitter, "30m")); err != nil || s.jitter < 0 {
+		fmt.Fprintln(os.Stderr, "随机延迟格式错误：", pick(jitter, cfg.Daemon.Jitter, "30m"))
+		return 2
+	}
+	listen = pick(listen, cfg.Daemon.Listen, "")
+
+	// spread the first checks over the jitter window so jobs do not start at once
+	now := time.Now()
+	jobs := map[*scheduleEntry]*config.Job{}
+	for i := range cfg.Jobs {
+		entry := &scheduleEntry{Job: cfg.Jobs[i].Name, NextRun: now}
+		if s.jitter > 0 {
+			entry.NextRun = now.Add(time.Duration(rand.Int63n(int64(s.jitter))))
+		}
+		if last, err := state.Open(cfg.Jobs[i].State).Last(cfg.Jobs[i].Name); err != nil {
+			fmt.Fprintln(os.Stderr, "读取状态文件失败：", err)
+		} else if last != nil {
+			entry.LastRun, entry.LastResult = &last.End, runResult(last)
+		}
+		s.entries = append(s.entries, entry)
+		jobs[entry] = &cfg.Jobs[i]
+	}
+
+	if listen != "" {
+		mux := http.NewServeMux()
+		mux.Handle("/schedule", s)
+		go func() {
+			if err := http.ListenAndServe(listen, mux); err != nil {
+				fmt.Fprintln(os.Stderr, "计划查询服务启动失败：", err)
+			}
+		}()
+		fmt.Println("计划查询地址：", "http://"+listen+"/schedule")
+	}
+
+	watchSignals()
+	fmt.Printf("守护模式已启动，共 %d 个任务，检查间隔 %s，随机延迟 %s\n", len(s.entries), s.interval, s.jitter)
+	s.printSchedule()
+	for {
+		var due *scheduleEntry
+		s.mu.Lock()
+		for _, entry := range s.entries {
+			if due == nil || entry.NextRun.Before(due.NextRun) {
+				due = entry
+			}
+		}
+		wait := time.Until(due.NextRun)
+		s.mu.Unlock()
+		if wait > 0 {
+			time.Sleep(wait)
+		}
+
+		s.mu.Lock()
+		due.Running = true
+		s.mu.Unlock()
+		fmt.Printf("==== 任务 %s（%s）====\n", due.Job, time.Now().Format("2006-01-02 15:04:05"))
+		err := runScheduled(jobs[due], &e)
+		result := "成功"
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			result = "失败：" + err.Error()
+		}
+		s.mu.Lock()
+		finished := time.Now()
+		due.Running = false
+		due.LastRun = &finished
+		due.LastResult = result
+		due.NextRun = s.next(finished)
+		s.mu.Unlock()
+		fmt.Printf("任务 %s %s，下次执行 %s\n", due.Job, result, due.NextRun.Local().Format("2006-01-02 15:04:05"))
+	}
+}
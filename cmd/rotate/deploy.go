@@ -0,0 +1,215 @@
+package main
+
+import (
+	"context"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"auto-https/internal/certs"
+	"auto-https/internal/config"
+	"auto-https/internal/state"
+)
+
+// deployment is what a job's deployers share: the validated certificate and
+// the run being recorded.
+type deployment struct {
+	job    *config.Job
+	env    *env
+	files  certs.Files
+	bundle *certs.Bundle
+	run    *state.Run
+	// casRegion is the region of the Certificate Management Service
+	// certificate in run.CASCertID.
+	casRegion string
+	// snap holds the certificate files as they were before renewal; it is
+	// only taken when nginx_restore is set.
+	snap *certs.Snapshot
+}
+
+func (d *deployment) leaf() *x509.Certificate { return d.bundle.Leaf() }
+
+// Deployer is one deploy target. Prepare runs for every target before any is
+// deployed and must not change anything remote; Deploy and Verify then run
+// target by target. Rollback undoes Deploy when this or a later target fails.
+type Deployer interface {
+	Name() string
+	Prepare(ctx context.Context, d *deployment) error
+	Deploy(ctx context.Context, d *deployment) error
+	Verify(ctx context.Context, d *deployment) error
+	Rollback(ctx context.Context, d *deployment) error
+}
+
+// finisher is implemented by deployers with cleanup that would make rollback
+// impossible, so it only runs once every target succeeded.
+type finisher interface {
+	Finish(ctx context.Context, d *deployment) error
+}
+
+// planner is implemented by deployers that can describe their steps for
+// --dry-run using read-only calls.
+type planner interface {
+	Plan(ctx context.Context, d *deployment, p *plan) error
+}
+
+// deployerTypes builds a deployer for each deploy type. Adding a target only
+// needs an entry here.
+var deployerTypes = map[string]func(c config.Deploy, explicit bool) Deployer{
+	config.DeployNginx: func(c config.Deploy, explicit bool) Deployer {
+		return &nginxDeployer{name: c.Name}
+	},
+	config.DeployQiniu: func(c config.Deploy, explicit bool) Deployer {
+		return &qiniuDeployer{name: c.Name, optional: !explicit}
+	},
+	config.DeployCommand: func(c config.Deploy, explicit bool) Deployer {
+		return &commandDeployer{conf: c}
+	},
+	config.DeployAliyunCDN: func(c config.Deploy, explicit bool) Deployer {
+		return &aliyunCDNDeployer{conf: c}
+	},
+	config.DeployAliyunDCDN: func(c config.Deploy, explicit bool) Deployer {
+		return &aliyunCDNDeployer{conf: c, dcdn: true}
+	},
+	config.DeployAliyunCAS: func(c config.Deploy, explicit bool) Deployer {
+		return &casDeployer{conf: c}
+	},
+	config.DeployAliyunSLB: func(c config.Deploy, explicit bool) Deployer {
+		return &lbDeployer{conf: c}
+	},
+	config.DeployAliyunALB: func(c config.Deploy, explicit bool) Deployer {
+		return &lbDeployer{conf: c, alb: true}
+	},
+}
+
+// deployList is the job's deploy list, or the historical order when none is
+// configured: nginx unless qiniu_only, then qiniu.
+func deployList(j *config.Job) (list []config.Deploy, explicit bool) {
+	if len(j.Deploy) > 0 {
+		return j.Deploy, true
+	}
+	if !config.On(j.QiniuOnly) {
+		list = append(list, config.Deploy{Type: config.DeployNginx})
+	}
+	return append(list, config.Deploy{Type: config.DeployQiniu}), false
+}
+
+func newDeployers(j *config.Job) ([]Deployer, error) {
+	list, explicit := deployList(j)
+	var ds []Deployer
+	for _, c := range list {
+		build, ok := deployerTypes[c.Type]
+		if !ok {
+			return nil, fmt.Errorf("未知的部署类型：%q", c.Type)
+		}
+		if c.Name == "" {
+			c.Name = c.Type
+		}
+		ds = append(ds, build(c, explicit))
+	}
+	return ds, nil
+}
+
+// deployAll prepares every target before touching any, then deploys and
+// verifies them in order. When a target fails, it and every target before it
+// are rolled back in reverse order.
+func deployAll(ctx context.Context, d *deployment, ds []Deployer) error {
+	for _, dp := range ds {
+		if err := dp.Prepare(ctx, d); err != nil {
+			return fmt.Errorf("%s 部署准备失败：%w", dp.Name(), err)
+		}
+	}
+	for i, dp := range ds {
+		err := dp.Deploy(ctx, d)
+		if err != nil {
+			err = fmt.Errorf("%s 部署失败：%w", dp.Name(), err)
+		} else if err = dp.Verify(ctx, d); err != nil {
+			err = fmt.Errorf("%s 部署校验失败：%w", dp.Name(), err)
+		}
+		if err == nil {
+			continue
+		}
+		fmt.Fprintln(os.Stderr, err)
+		for k := i; k >= 0; k-- {
+			fmt.Println("回滚部署目标：", ds[k].Name())
+			if rerr := ds[k].Rollback(ctx, d); rerr != nil {
+				fmt.Fprintln(os.Stderr, "回滚失败，请手动检查：", ds[k].Name(), rerr)
+			}
+		}
+		return err
+	}
+	for _, dp := range ds {
+		if f, ok := dp.(finisher); ok {
+			if err := f.Finish(ctx, d); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+			}
+		}
+	}
+	return nil
+}
+
+// commandDeployer runs user supplied shell hooks. Each hook sees the
+// certificate in CERT_* environment variables; empty hooks are skipped.
+type commandDeployer struct {
+	conf config.Deploy
+}
+
+func (c *commandDeployer) Name() string { return c.conf.Name }
+
+func (c *commandDeployer) Prepare(ctx context.Context, d *deployment) error {
+	return c.hook(ctx, d, c.conf.Prepare)
+}
+
+func (c *commandDeployer) Deploy(ctx context.Context, d *deployment) error {
+	return c.hook(ctx, d, c.conf.Command)
+}
+
+func (c *commandDeployer) Verify(ctx context.Context, d *deployment) error {
+	return c.hook(ctx, d, c.conf.Verify)
+}
+
+func (c *commandDeployer) Rollback(ctx context.Context, d *deployment) error {
+	return c.hook(ctx, d, c.conf.Rollback)
+}
+
+func (c *commandDeployer) Plan(ctx context.Context, d *deployment, p *plan) error {
+	for _, h := range []struct{ stage, cmd string }{
+		{"准备", c.conf.Prepare}, {"部署", c.conf.Command}, {"校验", c.conf.Verify},
+	} {
+		if h.cmd != "" {
+			p.step("%s（%s）：执行 %s", c.Name(), h.stage, h.cmd)
+		}
+	}
+	if c.conf.Rollback != "" {
+		p.step("%s：失败时执行 %s", c.Name(), c.conf.Rollback)
+	}
+	return nil
+}
+
+func (c *commandDeployer) hook(ctx context.Context, d *deployment, command string) error {
+	if command == "" {
+		return nil
+	}
+	cmd := exec.CommandContext(ctx, "sh", "-c", command)
+	cmd.Env = append(os.Environ(), certEnv(d)...)
+	out, err := cmd.CombinedOutput()
+	if len(out) > 0 {
+		fmt.Println(string(out))
+	}
+	return err
+}
+
+func certEnv(d *deployment) []string {
+	leaf := d.leaf()
+	return []string{
+		"CERT_NAME=" + d.files.Name,
+		"CERT_KEY_FILE=" + d.files.KeyPath,
+		"CERT_CHAIN_FILE=" + d.files.ChainPath,
+		"CERT_DOMAINS=" + strings.Join(leaf.DNSNames, ","),
+		"CERT_SERIAL=" + leaf.SerialNumber.Text(16),
+		"CERT_NOT_AFTER=" + leaf.NotAfter.UTC().Format(time.RFC3339),
+		"CERT_FINGERPRINT=" + certs.Fingerprint(leaf),
+	}
+}
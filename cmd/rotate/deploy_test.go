@@ -0,0 +1,193 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"auto-https/internal/certs"
+	"auto-https/internal/config"
+)
+
+// fakeDeployer appends "<stage> <name>" to a shared log and fails the stage
+// named in fail.
+type fakeDeployer struct {
+	name string
+	fail string
+	log  *[]string
+}
+
+func (f *fakeDeployer) step(stage string) error {
+	*f.log = append(*f.log, stage+" "+f.name)
+	if stage == f.fail {
+		return errors.New(stage + " failed")
+	}
+	return nil
+}
+
+func (f *fakeDeployer) Name() string { return f.name }
+
+func (f *fakeDeployer) Prepare(ctx context.Context, d *deployment) error { return f.step("prepare") }
+
+func (f *fakeDeployer) Deploy(ctx context.Context, d *deployment) error { return f.step("deploy") }
+
+func (f *fakeDeployer) Verify(ctx context.Context, d *deployment) error { return f.step("verify") }
+
+func (f *fakeDeployer) Rollback(ctx context.Context, d *deployment) error { return f.step("rollback") }
+
+func (f *fakeDeployer) Finish(ctx context.Context, d *deployment) error { return f.step("finish") }
+
+func TestDeployAll(t *testing.T) {
+	tests := []struct {
+		name string
+		// fail maps a deployer to the stage it fails
+		fail    map[string]string
+		wantErr string
+		want    []string
+	}{
+		{
+			name: "success",
+			want: []string{
+				"prepare a", "prepare b", "prepare c",
+				"deploy a", "verify a", "deploy b", "verify b", "deploy c", "verify c",
+				"finish a", "finish b", "finish c",
+			},
+		},
+		{
+			name:    "prepare fails",
+			fail:    map[string]string{"b": "prepare"},
+			wantErr: "b 部署准备失败",
+			want:    []string{"prepare a", "prepare b"},
+		},
+		{
+			name:    "deploy fails",
+			fail:    map[string]string{"b": "deploy"},
+			wantErr: "b 部署失败",
+			want: []string{
+				"prepare a", "prepare b", "prepare c",
+				"deploy a", "verify a", "deploy b",
+				"rollback b", "rollback a",
+			},
+		},
+		{
+			name:    "verify fails",
+			fail:    map[string]string{"c": "verify"},
+			wantErr: "c 部署校验失败",
+			want: []string{
+				"prepare a", "prepare b", "prepare c",
+				"deploy a", "verify a", "deploy b", "verify b", "deploy c", "verify c",
+				"rollback c", "rollback b", "rollback a",
+			},
+		},
+		{
+			name: "rollback failure does not stop the others",
+			fail: map[string]string{"a": "rollback", "b": "deploy"},
+			want: []string{
+				"prepare a", "prepare b", "prepare c",
+				"deploy a", "verify a", "deploy b",
+				"rollback b", "rollback a",
+			},
+			wantErr: "b 部署失败",
+		},
+		{
+			name: "finish failure is only reported",
+			fail: map[string]string{"a": "finish"},
+			want: []string{
+				"prepare a", "prepare b", "prepare c",
+				"deploy a", "verify a", "deploy b", "verify b", "deploy c", "verify c",
+				"finish a", "finish b", "finish c",
+			},
+		},
+	}
+	for _, tt := range tests {
+		var log []string
+		var ds []Deployer
+		for _, name := range []string{"a", "b", "c"} {
+			ds = append(ds, &fakeDeployer{name: name, fail: tt.fail[name], log: &log})
+		}
+		err := deployAll(context.Background(), &deployment{}, ds)
+		switch {
+		case tt.wantErr == "" && err != nil:
+			t.Errorf("%s: %v", tt.name, err)
+		case tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)):
+			t.Errorf("%s: error %v, want %q", tt.name, err, tt.wantErr)
+		}
+		if !slices.Equal(log, tt.want) {
+			t.Errorf("%s:\n got %v\nwant %v", tt.name, log, tt.want)
+		}
+	}
+}
+
+func TestNewDeployers(t *testing.T) {
+	ds, err := newDeployers(&config.Job{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ds) != 2 || ds[0].Name() != config.DeployNginx || ds[1].Name() != config.DeployQiniu {
+		t.Errorf("default deployers %v", ds)
+	}
+	if q, ok := ds[1].(*qiniuDeployer); !ok || !q.optional {
+		t.Errorf("default qiniu target not optional: %#v", ds[1])
+	}
+	ds, err = newDeployers(&config.Job{QiniuOnly: config.Bool(true)})
+	if err != nil || len(ds) != 1 || ds[0].Name() != config.DeployQiniu {
+		t.Errorf("qiniu_only deployers %v, %v", ds, err)
+	}
+	ds, err = newDeployers(&config.Job{Deploy: []config.Deploy{{Type: config.DeployCommand, Name: "hook"}, {Type: config.DeployQiniu}}})
+	if err != nil || len(ds) != 2 || ds[0].Name() != "hook" {
+		t.Fatalf("configured deployers %v, %v", ds, err)
+	}
+	if q := ds[1].(*qiniuDeployer); q.optional {
+		t.Error("configured qiniu target is optional")
+	}
+	if _, err := newDeployers(&config.Job{Deploy: []config.Deploy{{Type: "ftp"}}}); err == nil {
+		t.Error("unknown deploy type accepted")
+	}
+}
+
+func TestCommandDeployerEnv(t *testing.T) {
+	dir := t.TempDir()
+	leaf := newTestCA(t).issue(t, dir, 90*24*time.Hour, "example.com", "www.example.com")
+	files := certs.Files{Name: "example.com", KeyPath: filepath.Join(dir, "privkey.pem"), ChainPath: filepath.Join(dir, "fullchain.pem")}
+	bundle, err := certs.LoadBundle(files.KeyPath, files.ChainPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := &deployment{files: files, bundle: bundle}
+
+	out := filepath.Join(dir, "env")
+	c := &commandDeployer{conf: config.Deploy{
+		Name:     "hook",
+		Command:  "env | grep ^CERT_ | sort > " + out,
+		Rollback: "exit 3",
+	}}
+	for _, stage := range []func(context.Context, *deployment) error{c.Prepare, c.Deploy, c.Verify} {
+		if err := stage(context.Background(), d); err != nil {
+			t.Fatal(err)
+		}
+	}
+	b, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"CERT_CHAIN_FILE=" + files.ChainPath,
+		"CERT_DOMAINS=example.com,www.example.com",
+		"CERT_FINGERPRINT=" + certs.Fingerprint(leaf),
+		"CERT_KEY_FILE=" + files.KeyPath,
+		"CERT_NAME=example.com",
+		"CERT_NOT_AFTER=" + leaf.NotAfter.UTC().Format(time.RFC3339),
+		"CERT_SERIAL=" + leaf.SerialNumber.Text(16),
+	}
+	if got := strings.Split(strings.TrimSpace(string(b)), "\n"); !slices.Equal(got, want) {
+		t.Errorf("hook environment:\n got %q\nwant %q", got, want)
+	}
+	if err := c.Rollback(context.Background(), d); err == nil {
+		t.Error("failing rollback hook reported success")
+	}
+}
@@ -0,0 +1,524 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"slices"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"auto-https/internal/acme"
+	"auto-https/internal/aliyun"
+	"auto-https/internal/certs"
+	"auto-https/internal/config"
+	"auto-https/internal/dns"
+	"auto-https/internal/qiniu"
+	"auto-https/internal/retry"
+	"auto-https/internal/state"
+	"auto-https/internal/tlscheck"
+)
+
+// env carries credentials and settings shared by all jobs of one invocation.
+type env struct {
+	aliyunAK   string
+	aliyunSK   string
+	qiniuAK    string
+	qiniuSK    string
+	qiniuToken string
+	pageSize   int
+	acme       config.ACME
+	dryRun     bool
+	timeout    time.Duration
+	retries    int
+	verbose    bool
+}
+
+// addRetryFlags registers the per-call timeout and retry count shared by all
+// subcommands that reach remote APIs.
+func addRetryFlags(fs *flag.FlagSet, e *env) {
+	fs.DurationVar(&e.timeout, "timeout", retry.Default.Timeout, "单次远程调用（阿里云、七牛、ACME）超时")
+	fs.IntVar(&e.retries, "retries", retry.Default.Attempts-1, "远程调用失败（限流、5xx、网络错误）后的最大重试次数")
+}
+
+func (e *env) retry() retry.Policy {
+	p := retry.Default
+	p.Attempts = e.retries + 1
+	p.Timeout = e.timeout
+	p.OnRetry = func(op string, attempt int, err error, wait time.Duration) {
+		fmt.Fprintf(os.Stderr, "%s 第 %d 次调用失败，%s 后重试：%v\n", op, attempt, wait.Round(time.Millisecond), err)
+	}
+	return p
+}
+
+func (e *env) qiniu() *qiniu.Client {
+	c := qiniu.New(e.qiniuAK, e.qiniuSK)
+	c.TokenMode = e.qiniuToken
+	c.Retry = e.retry()
+	return c
+}
+
+func (e *env) aliyunDNS() (*dns.Aliyun, error) {
+	c, err := dns.NewAliyun(e.aliyunAK, e.aliyunSK)
+	if err != nil {
+		return nil, err
+	}
+	c.PageSize = int64(e.pageSize)
+	c.Retry = e.retry()
+	return c, nil
+}
+
+func (e *env) aliyunCDN(endpoint string, dcdn bool) (*aliyun.CDN, error) {
+	c, err := aliyun.NewCDN(e.aliyunAK, e.aliyunSK, endpoint, dcdn)
+	if err != nil {
+		return nil, err
+	}
+	c.Retry = e.retry()
+	return c, nil
+}
+
+func (e *env) aliyunCAS(endpoint string) (*aliyun.CAS, error) {
+	c, err := aliyun.NewCAS(e.aliyunAK, e.aliyunSK, endpoint)
+	if err != nil {
+		return nil, err
+	}
+	c.Retry = e.retry()
+	return c, nil
+}
+
+func (e *env) aliyunSLB(region, endpoint string) (*aliyun.SLB, error) {
+	c, err := aliyun.NewSLB(e.aliyunAK, e.aliyunSK, region, endpoint)
+	if err != nil {
+		return nil, err
+	}
+	c.Retry = e.retry()
+	return c, nil
+}
+
+func (e *env) aliyunALB(region, endpoint string) (*aliyun.ALB, error) {
+	c, err := aliyun.NewALB(e.aliyunAK, e.aliyunSK, region, endpoint)
+	if err != nil {
+		return nil, err
+	}
+	c.Retry = e.retry()
+	return c, nil
+}
+
+// restoreTimeout bounds the DNS restore run from the signal handler and
+// deferred cleanup, independent of the job's own context.
+const restoreTimeout = 2 * time.Minute
+
+// exitError is a job failure together with the exit code used in single-job mode.
+type exitError struct {
+	code int
+	msg  string
+}
+
+func (e *exitError) Error() string { return e.msg }
+
+func fail(code int, a ...any) error {
+	return &exitError{code: code, msg: strings.TrimSuffix(fmt.Sprintln(a...), "\n")}
+}
+
+func exitCode(err error) int {
+	if e, ok := err.(*exitError); ok {
+		return e.code
+	}
+	return 1
+}
+
+// activeSwap is the DNS swap currently in effect, restored on SIGINT/SIGTERM.
+var activeSwap struct {
+	sync.Mutex
+	swap   *dns.Swap
+	labels []string
+}
+
+func watchSignals() {
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		sig := <-sigs
+		fmt.Fprintln(os.Stderr, "收到信号", sig)
+		activeSwap.Lock()
+		swap, labels := activeSwap.swap, activeSwap.labels
+		activeSwap.Unlock()
+		if swap != nil {
+			fmt.Fprintln(os.Stderr, "正在恢复解析记录")
+			restoreSwap(swap, labels)
+		}
+		os.Exit(1)
+	}()
+}
+
+func setActiveSwap(swap *dns.Swap, labels ...string) {
+	activeSwap.Lock()
+	activeSwap.swap, activeSwap.labels = swap, labels
+	activeSwap.Unlock()
+}
+
+func restoreSwap(swap *dns.Swap, labels []string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), restoreTimeout)
+	defer cancel()
+	if err := swap.Restore(ctx); err != nil {
+		fmt.Fprintln(os.Stderr, "恢复解析记录失败，请手动检查：", err)
+		return err
+	}
+	fmt.Println("已恢复记录原状态", strings.Join(labels, " "))
+	return nil
+}
+
+func validateJob(j *config.Job) error {
+	if j.Domain == "" && j.CertDomain == "" {
+		return fail(2, "必须提供 --domain 或 --cert-domain")
+	}
+	if _, err := certs.ParseRenewWindow(j.RenewBefore); err != nil {
+		return fail(2, "--renew-before 格式错误：", err)
+	}
+	switch j.Renewer {
+	case config.RenewerCertbot, config.RenewerACME, config.RenewerNone:
+	default:
+		return fail(2, "renewer 仅支持 certbot、acme 或 none")
+	}
+	switch j.CertSource {
+	case config.SourceCertbot, config.SourceCertbotLive:
+	case config.SourceAcmeSh, config.SourceLego:
+		if j.CertDomain == "" {
+			return fail(2, j.CertSource, "证书来源需要提供 --cert-domain")
+		}
+	case config.SourceFiles:
+		if j.CertFile == "" || j.KeyFile == "" {
+			return fail(2, "files 证书来源需要提供 --cert-file 与 --key-file")
+		}
+	default:
+		return fail(2, "cert-source 仅支持 certbot、certbot-live、acme.sh、lego 或 files")
+	}
+	if j.Renewer == config.RenewerACME && j.CertSource != config.SourceCertbot && j.CertSource != config.SourceCertbotLive {
+		return fail(2, "内置 ACME 客户端按 certbot 目录格式保存证书，cert-source 需为 certbot 或 certbot-live")
+	}
+	if d, err := time.ParseDuration(j.NginxCheckTimeout); err != nil || d <= 0 {
+		return fail(2, "--nginx-check-timeout 格式错误：", j.NginxCheckTimeout)
+	}
+	for _, c := range j.NginxCheck {
+		if _, err := tlscheck.ParseTarget(c); err != nil {
+			return fail(2, "--nginx-check 格式错误：", c)
+		}
+	}
+	if d, err := time.ParseDuration(j.QiniuVerifyTimeout); err != nil || d < 0 {
+		return fail(2, "--qiniu-verify-timeout 格式错误：", j.QiniuVerifyTimeout)
+	}
+	cas := false
+	for _, d := range j.Deploy {
+		switch d.Type {
+		case config.DeployAliyunCAS:
+			cas = true
+		case config.DeployAliyunALB:
+			if !cas && hasDeploy(j, config.DeployAliyunCAS) {
+				return fail(2, "aliyun-cas 部署目标需排在 aliyun-alb 之前")
+			}
+		}
+		if _, ok := deployerTypes[d.Type]; !ok {
+			return fail(2, "未知的部署类型：", d.Type)
+		}
+		if d.Type == config.DeployCommand && d.Command == "" {
+			return fail(2, "command 部署目标需要提供 command")
+		}
+		if d.Type == config.DeployAliyunSLB || d.Type == config.DeployAliyunALB {
+			if len(d.Listeners) == 0 {
+				return fail(2, d.Type, "部署目标需要提供 listeners")
+			}
+			for _, l := range d.Listeners {
+				if _, _, err := parseListener(l); err != nil {
+					return fail(2, "listeners 格式错误，应为 <负载均衡实例ID>:<端口>：", l)
+				}
+			}
+		}
+		if d.VerifyTimeout != "" {
+			if t, err := time.ParseDuration(d.VerifyTimeout); err != nil || t < 0 {
+				return fail(2, "verify_timeout 格式错误：", d.VerifyTimeout)
+			}
+		}
+	}
+	if j.ACMEChallenge != "http-01" && j.ACMEChallenge != "dns-01" {
+		return fail(2, "--acme-challenge 仅支持 http-01 或 dns-01")
+	}
+	if j.Renewer == config.RenewerACME && j.ACMEChallenge == "dns-01" && j.Domain == "" {
+		return fail(2, "dns-01 验证需要提供 --domain")
+	}
+	return nil
+}
+
+// targetDomains are the CDN domains the job deploys to: qiniu_domains, or else
+// cert_domain, or else rr-a.domain.
+func targetDomains(j *config.Job) []string {
+	if len(j.QiniuDomains) > 0 {
+		return j.QiniuDomains
+	}
+	if j.CertDomain != "" {
+		return []string{j.CertDomain}
+	}
+	return []string{j.RRA + "." + j.Domain}
+}
+
+// verifyHosts is every name the certificate is deployed for: the job's
+// target domains and the domains listed on its deploy targets.
+func verifyHosts(j *config.Job) []string {
+	hosts := append([]string{}, targetDomains(j)...)
+	for _, d := range j.Deploy {
+		for _, h := range d.Domains {
+			if !slices.Contains(hosts, h) {
+				hosts = append(hosts, h)
+			}
+		}
+	}
+	return hosts
+}
+
+// certSource returns where the job's key and fullchain are read from. The
+// certbot layouts choose among all their directories by content when no
+// cert_domain is set; with --verbose every candidate is explained.
+func certSource(j *config.Job, e *env) certs.Source {
+	hosts := targetDomains(j)
+	var explain func(certs.Candidate)
+	if e.verbose {
+		explain = func(c certs.Candidate) {
+			switch {
+			case c.Selected:
+				fmt.Printf("候选证书 %s：选用，到期 %s\n", c.Name, c.NotAfter.Local().Format("2006-01-02 15:04"))
+			case c.Err != nil:
+				fmt.Printf("候选证书 %s：不符合，%v\n", c.Name, c.Err)
+			default:
+				fmt.Printf("候选证书 %s：覆盖目标域名，但到期 %s 早于选用的证书\n", c.Name, c.NotAfter.Local().Format("2006-01-02 15:04"))
+			}
+		}
+	}
+	switch j.CertSource {
+	case config.SourceCertbotLive:
+		return &certs.CertbotLive{Dir: j.CertbotLive, Domain: j.CertDomain, Hosts: hosts, Explain: explain}
+	case config.SourceAcmeSh:
+		return &certs.AcmeSh{Home: j.CertDir, Domain: j.CertDomain}
+	case config.SourceLego:
+		return &certs.Lego{Path: j.CertDir, Domain: j.CertDomain}
+	case config.SourceFiles:
+		return &certs.Explicit{Name: j.CertDomain, KeyPath: j.KeyFile, ChainPath: j.CertFile}
+	}
+	return &certs.CertbotArchive{Dir: j.CertbotLive, Domain: j.CertDomain, Hosts: hosts, Explain: explain}
+}
+
+// loadBundle reads the key and chain about to be deployed and verifies them
+// for hosts. The bundle is returned whenever it could be parsed, so callers
+// can report which certificate was refused.
+func loadBundle(j *config.Job, privPath, fullchainPath string, hosts []string) (*certs.Bundle, error) {
+	b, err := certs.LoadBundle(privPath, fullchainPath)
+	if err != nil {
+		return nil, err
+	}
+	opts := certs.VerifyOptions{Hosts: hosts}
+	if j.TrustedCA != "" {
+		if opts.Roots, err = certs.LoadPool(j.TrustedCA); err != nil {
+			return b, err
+		}
+	}
+	return b, b.Verify(opts)
+}
+
+// deployedSerial is the serial of the certificate deployed by the job's last
+// successful run, or "" when there is none.
+func deployedSerial(j *config.Job) (string, error) {
+	last, err := state.Open(j.State).LastSuccess(j.Name)
+	if err != nil || last == nil {
+		return "", err
+	}
+	return last.CertSerial, nil
+}
+
+func runJob(j *config.Job, e *env) (err error) {
+	if e.dryRun {
+		return planJob(j, e)
+	}
+	if err := validateJob(j); err != nil {
+		return err
+	}
+	ctx := context.Background()
+	run := state.Run{Start: time.Now(), Outcome: state.OutcomeSuccess}
+	defer func() {
+		// a panic is recorded as a failure, then passed on
+		p := recover()
+		if p != nil {
+			err = fmt.Errorf("panic: %v", p)
+		}
+		run.End = time.Now()
+		if err != nil {
+			run.Outcome = state.OutcomeFailed
+			run.Error = err.Error()
+		}
+		if serr := state.Open(j.State).Record(j.Name, run); serr != nil {
+			fmt.Fprintln(os.Stderr, "写入状态文件失败：", serr)
+		}
+		if p != nil {
+			panic(p)
+		}
+	}()
+	window, _ := certs.ParseRenewWindow(j.RenewBefore)
+	dns01 := j.Renewer == config.RenewerACME && j.ACMEChallenge == "dns-01"
+	// the swap points the domain at this host for HTTP validation only
+	swapRecords := !config.On(j.QiniuOnly) && !dns01 && j.Renewer != config.RenewerNone
+	rrA, rrB := j.RRA+"."+j.Domain, j.RRB+"."+j.Domain
+
+	if swapRecords || dns01 {
+		if e.aliyunAK == "" || e.aliyunSK == "" {
+			return fail(2, "缺少阿里云凭证：请设置 ALICLOUD_ACCESS_KEY_ID 和 ALICLOUD_ACCESS_KEY_SECRET")
+		}
+	}
+
+	var prev *certs.Files
+	if !config.On(j.QiniuOnly) {
+		if files, err := certSource(j, e).Locate(); err != nil {
+			fmt.Println("未找到现有证书，将执行续期：", err)
+		} else {
+			prev = &files
+		}
+	}
+	if prev != nil && !config.On(j.Force) {
+		files := *prev
+		leaf, err := certs.LoadLeaf(files.ChainPath)
+		switch {
+		case err != nil:
+			fmt.Fprintln(os.Stderr, "解析现有证书失败，将执行续期：", err)
+		case j.Renewer == config.RenewerNone:
+			// renewed by other tooling: deploy whenever the certificate changed
+			serial := leaf.SerialNumber.Text(16)
+			if deployed, err := deployedSerial(j); err != nil {
+				fmt.Fprintln(os.Stderr, "读取状态文件失败，将执行部署：", err)
+			} else if serial == deployed {
+				fmt.Printf("证书 %s（序列号 %s）已部署，本次跳过。\n", files.ChainPath, serial)
+				run.Outcome = state.OutcomeSkipped
+				run.CertSerial = serial
+				run.CertNotAfter = &leaf.NotAfter
+				return nil
+			} else {
+				fmt.Printf("证书 %s（序列号 %s）尚未部署，开始部署。\n", files.ChainPath, serial)
+			}
+		case !window.Due(leaf, time.Now()):
+			fmt.Printf("证书 %s 到期时间 %s，未到续期时间 %s，本次跳过。\n",
+				files.ChainPath, leaf.NotAfter.Local().Format("2006-01-02 15:04"), window.RenewAt(leaf).Local().Format("2006-01-02 15:04"))
+			run.Outcome = state.OutcomeSkipped
+			run.CertSerial = leaf.SerialNumber.Text(16)
+			run.CertNotAfter = &leaf.NotAfter
+			return nil
+		default:
+			fmt.Printf("证书 %s 将于 %s 到期，开始续期。\n", files.ChainPath, leaf.NotAfter.Local().Format("2006-01-02 15:04"))
+		}
+	}
+
+	var provider dns.Provider
+	if swapRecords || dns01 {
+		aliyun, err := e.aliyunDNS()
+		if err != nil {
+			return fail(1, "初始化阿里云DNS客户端失败：", err)
+		}
+		provider = aliyun
+	}
+
+	var swap *dns.Swap
+	if swapRecords {
+		records, err := provider.ListRecords(ctx, j.Domain)
+		if err != nil {
+			return fail(1, "查询云解析记录失败：", err)
+		}
+		fmt.Printf("云解析记录总数：%d\n", len(records))
+
+		a := dns.MatchRecord(records, j.RRA, j.Type, j.ValueA)
+		b := dns.MatchRecord(records, j.RRB, j.Type, j.ValueB)
+		if a == nil || b == nil {
+			return fail(3, "未找到 a 或 b 主机记录，请检查 --rr-a/--rr-b 与记录类型/记录值")
+		}
+		swap = &dns.Swap{Provider: provider, Disable: *a, Enable: *b}
+	}
+
+	// do not update record values; values are only used for matching
+
+	if swapRecords {
+		// registered first so a signal while Apply is still retrying restores too
+		setActiveSwap(swap, rrA, rrB)
+		if err := swap.Apply(ctx); err != nil {
+			setActiveSwap(nil)
+			return fail(1, "切换 a/b 主机记录失败，已尝试恢复原状态：", err)
+		}
+		fmt.Println("已暂停记录", rrA)
+		fmt.Println("已启用记录", rrB)
+		run.DNSActions = append(run.DNSActions, "disable "+rrA+" "+swap.Disable.ID, "enable "+rrB+" "+swap.Enable.ID)
+		defer func() {
+			if r := recover(); r != nil {
+				err = fail(1, "执行异常：", r)
+			}
+			setActiveSwap(nil)
+			if restoreSwap(swap, []string{rrA, rrB}) != nil {
+				run.DNSActions = append(run.DNSActions, "restore failed")
+				if err == nil {
+					err = fail(1, "恢复解析记录失败")
+				}
+			} else {
+				run.DNSActions = append(run.DNSActions, "restore "+rrA+" "+rrB)
+			}
+		}()
+	}
+
+	hosts := verifyHosts(j)
+
+	var snap *certs.Snapshot
+	if prev != nil && config.On(j.NginxRestore) {
+		if snap, err = certs.TakeSnapshot(restorePaths(*prev)...); err != nil {
+			return fail(1, "备份现有证书文件失败：", err)
+		}
+	}
+
+	if !config.On(j.QiniuOnly) {
+		switch j.Renewer {
+		case config.RenewerACME:
+			names := acmeNames(j)
+			var solver acme.Solver = &acme.WebrootSolver{Root: j.ACMEWebroot}
+			if dns01 {
+				solver = &acme.DNS01Solver{Provider: provider, Zone: j.Domain, Nameserver: e.acme.DNSServer}
+				run.DNSActions = append(run.DNSActions, "dns-01 TXT _acme-challenge."+j.Domain)
+			}
+			privPath, fullchainPath, err := obtainCert(e.acme, e.retry(), names, solver, j.CertbotLive)
+			if err != nil {
+				return fail(1, "ACME 签发证书失败：", err)
+			}
+			fmt.Println("ACME 证书已保存：", privPath, fullchainPath)
+		case config.RenewerCertbot:
+			if err := runCmd("certbot", "renew"); err != nil {
+				return fail(1, "执行 certbot renew 失败：", err)
+			}
+		}
+	}
+
+	files, err := certSource(j, e).Locate()
+	if err != nil {
+		return fail(1, "查找最新证书失败：", err)
+	}
+	bundle, err := loadBundle(j, files.KeyPath, files.ChainPath, hosts)
+	if bundle != nil {
+		run.CertSerial = bundle.Leaf().SerialNumber.Text(16)
+		run.CertNotAfter = &bundle.Leaf().NotAfter
+	}
+	if err != nil {
+		return fail(1, "证书校验失败，拒绝部署：", err)
+	}
+	fmt.Println("证书校验通过：", files.ChainPath)
+
+	ds, err := newDeployers(j)
+	if err != nil {
+		return fail(2, err)
+	}
+	d := &deployment{job: j, env: e, files: files, bundle: bundle, run: &run, snap: snap}
+	if err := deployAll(ctx, d, ds); err != nil {
+		return fail(1, err)
+	}
+	return nil
+}
@@ -0,0 +1,224 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"auto-https/internal/certs"
+	"auto-https/internal/config"
+	"auto-https/internal/state"
+)
+
+// testCA signs leaf certificates for tests and writes them as the
+// privkey.pem/fullchain.pem pair the certificate sources read.
+type testCA struct {
+	key    *ecdsa.PrivateKey
+	cert   *x509.Certificate
+	serial int64
+}
+
+func newTestCA(t *testing.T) *testCA {
+	t.Helper()
+	ca := &testCA{serial: 1}
+	var err error
+	if ca.key, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader); err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test root"},
+		NotBefore:             time.Now().Add(-365 * 24 * time.Hour),
+		NotAfter:              time.Now().Add(365 * 24 * time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &ca.key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ca.cert, err = x509.ParseCertificate(der); err != nil {
+		t.Fatal(err)
+	}
+	return ca
+}
+
+// writeRoot writes the CA certificate for use as trusted_ca.
+func (ca *testCA) writeRoot(t *testing.T, dir string) string {
+	t.Helper()
+	path := filepath.Join(dir, "root.pem")
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.cert.Raw}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// issue writes a key and certificate for names, valid from an hour ago for
+// lifetime, to dir/privkey.pem and dir/fullchain.pem.
+func (ca *testCA) issue(t *testing.T, dir string, lifetime time.Duration, names ...string) *x509.Certificate {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca.serial++
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(ca.serial),
+		Subject:      pkix.Name{CommonName: names[0]},
+		DNSNames:     names,
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(lifetime - time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "privkey.pem"), pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "fullchain.pem"), pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert
+}
+
+func TestRunJobRenewerNoneDeploysNewSerial(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCA(t)
+	out := filepath.Join(dir, "deployed")
+	j := &config.Job{
+		Name:       "files",
+		CertDomain: "www.example.com",
+		CertSource: config.SourceFiles,
+		CertFile:   filepath.Join(dir, "cert", "fullchain.pem"),
+		KeyFile:    filepath.Join(dir, "cert", "privkey.pem"),
+		Renewer:    config.RenewerNone,
+		State:      filepath.Join(dir, "state.json"),
+		TrustedCA:  ca.writeRoot(t, dir),
+		Deploy:     []config.Deploy{{Type: config.DeployCommand, Command: `echo "$CERT_SERIAL" >> ` + out}},
+	}
+	j.ApplyDefaults(config.Job{})
+	deployed := func() []string {
+		b, err := os.ReadFile(out)
+		if err != nil && !os.IsNotExist(err) {
+			t.Fatal(err)
+		}
+		return strings.Fields(string(b))
+	}
+	lastOutcome := func() string {
+		last, err := state.Open(j.State).Last(j.Name)
+		if err != nil || last == nil {
+			t.Fatalf("Last = %+v, %v", last, err)
+		}
+		return last.Outcome
+	}
+
+	// none of the certificates below is due for renewal
+	first := ca.issue(t, filepath.Join(dir, "cert"), 90*24*time.Hour, "www.example.com")
+	if err := runJob(j, &env{}); err != nil {
+		t.Fatal(err)
+	}
+	if got := deployed(); len(got) != 1 || got[0] != first.SerialNumber.Text(16) {
+		t.Fatalf("first run deployed %v", got)
+	}
+
+	if err := runJob(j, &env{}); err != nil {
+		t.Fatal(err)
+	}
+	if got := deployed(); len(got) != 1 || lastOutcome() != state.OutcomeSkipped {
+		t.Fatalf("unchanged certificate: deployed %v, outcome %s", got, lastOutcome())
+	}
+
+	// renewed by external tooling, long before the renew window
+	second := ca.issue(t, filepath.Join(dir, "cert"), 90*24*time.Hour, "www.example.com")
+	if err := runJob(j, &env{}); err != nil {
+		t.Fatal(err)
+	}
+	if got := deployed(); len(got) != 2 || got[1] != second.SerialNumber.Text(16) || lastOutcome() != state.OutcomeSuccess {
+		t.Fatalf("renewed certificate: deployed %v, outcome %s", got, lastOutcome())
+	}
+}
+
+// captureStdout returns what f prints to standard output.
+func captureStdout(t *testing.T, f func()) string {
+	t.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = w
+	done := make(chan []byte)
+	go func() {
+		b, _ := io.ReadAll(r)
+		done <- b
+	}()
+	defer func() {
+		os.Stdout = stdout
+	}()
+	f()
+	w.Close()
+	return string(<-done)
+}
+
+func TestCertSourceExplainsCandidates(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCA(t)
+	ca.issue(t, filepath.Join(dir, "old"), 30*24*time.Hour, "www.example.com")
+	ca.issue(t, filepath.Join(dir, "new"), 90*24*time.Hour, "www.example.com")
+	ca.issue(t, filepath.Join(dir, "other"), 90*24*time.Hour, "other.example.org")
+	j := &config.Job{CertSource: config.SourceCertbotLive, CertbotLive: dir, QiniuDomains: []string{"www.example.com"}}
+
+	for _, verbose := range []bool{false, true} {
+		var files certs.Files
+		var err error
+		out := captureStdout(t, func() {
+			files, err = certSource(j, &env{verbose: verbose}).Locate()
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if files.Name != "new" {
+			t.Errorf("verbose=%v: chose %s, want new", verbose, files.Name)
+		}
+		if !verbose {
+			if out != "" {
+				t.Errorf("printed without --verbose: %q", out)
+			}
+			continue
+		}
+		for _, want := range []string{
+			"候选证书 new：选用",
+			"候选证书 old：覆盖目标域名，但到期",
+			"候选证书 other：不符合，SANs other.example.org do not cover www.example.com",
+		} {
+			if !strings.Contains(out, want) {
+				t.Errorf("--verbose output lacks %q:\n%s", want, out)
+			}
+		}
+	}
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"context"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"auto-https/internal/certs"
+	"auto-https/internal/config"
+	"auto-https/internal/tlscheck"
+)
+
+// nginxDeployer reloads the local nginx so it picks up the renewed files.
+type nginxDeployer struct {
+	name string
+}
+
+func (n *nginxDeployer) Name() string { return n.name }
+
+func (n *nginxDeployer) Prepare(ctx context.Context, d *deployment) error {
+	return testNginx(d.job)
+}
+
+func (n *nginxDeployer) Deploy(ctx context.Context, d *deployment) error {
+	return runReload(d.job)
+}
+
+func (n *nginxDeployer) Verify(ctx context.Context, d *deployment) error {
+	if len(d.job.NginxCheck) == 0 {
+		return nil
+	}
+	if err := checkNginx(ctx, d.job, d.leaf()); err != nil {
+		return fmt.Errorf("nginx 未返回新证书：%w", err)
+	}
+	return nil
+}
+
+// Rollback puts the pre-renewal files back when nginx_restore is set;
+// otherwise nginx keeps serving the new certificate.
+func (n *nginxDeployer) Rollback(ctx context.Context, d *deployment) error {
+	if d.snap == nil {
+		fmt.Println("未启用 nginx_restore，nginx 保持使用新证书")
+		return nil
+	}
+	return restoreCertFiles(d.job, d.snap)
+}
+
+func (n *nginxDeployer) Plan(ctx context.Context, d *deployment, p *plan) error {
+	j := d.job
+	if len(j.Reload) == 0 {
+		p.step("执行 %s -t，检查通过后执行 %s -s reload", j.Nginx, j.Nginx)
+	}
+	for _, c := range j.ReloadTest {
+		p.step("执行配置检查 %s", c)
+	}
+	for _, c := range j.Reload {
+		p.step("执行 %s", c)
+	}
+	for _, c := range j.NginxCheck {
+		t, _ := tlscheck.ParseTarget(c)
+		p.step("TLS 检查 %s 在 %s 内返回选用的证书，否则任务失败", t, j.NginxCheckTimeout)
+	}
+	if config.On(j.NginxRestore) {
+		p.step("部署失败时恢复续期前的证书文件并重新重载")
+	}
+	return nil
+}
+
+// testNginx checks the configuration before a reload: nginx -t for the
+// default reload, the job's reload_test commands for custom ones.
+func testNginx(j *config.Job) error {
+	if len(j.Reload) == 0 {
+		if err := runCmd(j.Nginx, "-t"); err != nil {
+			return fmt.Errorf("nginx -t 配置检查失败，未重载：%w", err)
+		}
+		return nil
+	}
+	for _, c := range j.ReloadTest {
+		if err := runCmd("sh", "-c", c); err != nil {
+			return fmt.Errorf("配置检查失败，未重载：%s：%w", c, err)
+		}
+	}
+	return nil
+}
+
+func runReload(j *config.Job) error {
+	if len(j.Reload) == 0 {
+		if err := runCmd(j.Nginx, "-s", "reload"); err != nil {
+			return fmt.Errorf("重载 nginx 失败：%w", err)
+		}
+		return nil
+	}
+	for _, c := range j.Reload {
+		if err := runCmd("sh", "-c", c); err != nil {
+			return fmt.Errorf("执行重载命令失败：%s：%w", c, err)
+		}
+	}
+	return nil
+}
+
+// checkNginx waits until every nginx_check endpoint presents leaf.
+func checkNginx(ctx context.Context, j *config.Job, leaf *x509.Certificate) error {
+	timeout, _ := time.ParseDuration(j.NginxCheckTimeout)
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	fingerprint := certs.Fingerprint(leaf)
+	var failed []string
+	for _, c := range j.NginxCheck {
+		t, _ := tlscheck.ParseTarget(c)
+		if err := tlscheck.WaitFor(ctx, t.Addr, t.ServerName, fingerprint, 2*time.Second); err != nil {
+			fmt.Fprintln(os.Stderr, "TLS 检查失败：", t, err)
+			failed = append(failed, t.String())
+			continue
+		}
+		fmt.Printf("TLS 检查通过：%s 返回新证书（序列号 %s）\n", t, leaf.SerialNumber.Text(16))
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("%s", strings.Join(failed, ","))
+	}
+	return nil
+}
+
+// restorePaths are the files saved before renewal so nginx_restore can put
+// them back: the located pair plus the unnumbered certbot names beside it.
+func restorePaths(f certs.Files) []string {
+	paths := []string{f.KeyPath, f.ChainPath}
+	dir := filepath.Dir(f.ChainPath)
+	for _, name := range []string{"privkey.pem", "fullchain.pem", "cert.pem", "chain.pem"} {
+		paths = append(paths, filepath.Join(dir, name))
+	}
+	return paths
+}
+
+func restoreCertFiles(j *config.Job, snap *certs.Snapshot) error {
+	if err := snap.Restore(); err != nil {
+		return fmt.Errorf("恢复证书文件失败：%w", err)
+	}
+	fmt.Println("已恢复续期前的证书文件：", strings.Join(snap.Paths(), " "))
+	if err := testNginx(j); err != nil {
+		return err
+	}
+	return runReload(j)
+}
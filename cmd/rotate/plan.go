@@ -0,0 +1,149 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"auto-https/internal/certs"
+	"auto-https/internal/config"
+	"auto-https/internal/dns"
+	"auto-https/internal/state"
+)
+
+type plan struct {
+	n int
+}
+
+func (p *plan) step(format string, a ...any) {
+	p.n++
+	fmt.Printf("  %d. %s\n", p.n, fmt.Sprintf(format, a...))
+}
+
+// planJob resolves everything runJob would touch and prints the steps it
+// would take. It only performs read-only calls.
+func planJob(j *config.Job, e *env) error {
+	if err := validateJob(j); err != nil {
+		return err
+	}
+	ctx := context.Background()
+	window, _ := certs.ParseRenewWindow(j.RenewBefore)
+	dns01 := j.Renewer == config.RenewerACME && j.ACMEChallenge == "dns-01"
+	// the swap points the domain at this host for HTTP validation only
+	swapRecords := !config.On(j.QiniuOnly) && !dns01 && j.Renewer != config.RenewerNone
+	rrA, rrB := j.RRA+"."+j.Domain, j.RRB+"."+j.Domain
+
+	fmt.Printf("[dry-run] 任务 %s 执行计划（不会做任何修改）：\n", j.Name)
+	p := &plan{}
+
+	if !config.On(j.QiniuOnly) && !config.On(j.Force) {
+		if files, err := certSource(j, e).Locate(); err != nil {
+			p.step("未找到现有证书（%v），将执行续期", err)
+		} else if leaf, err := certs.LoadLeaf(files.ChainPath); err != nil {
+			p.step("解析现有证书失败（%v），将执行续期", err)
+		} else if j.Renewer == config.RenewerNone {
+			serial := leaf.SerialNumber.Text(16)
+			if deployed, err := deployedSerial(j); err != nil {
+				p.step("读取状态文件失败（%v），将执行部署", err)
+			} else if serial == deployed {
+				p.step("证书 %s（序列号 %s）已部署，跳过本任务", files.ChainPath, serial)
+				return nil
+			} else {
+				p.step("证书 %s（序列号 %s）尚未部署，需要部署", files.ChainPath, serial)
+			}
+		} else if !window.Due(leaf, time.Now()) {
+			p.step("证书 %s 到期时间 %s，未到续期时间 %s，跳过本任务", files.ChainPath,
+				leaf.NotAfter.Local().Format("2006-01-02 15:04"), window.RenewAt(leaf).Local().Format("2006-01-02 15:04"))
+			return nil
+		} else {
+			p.step("证书 %s 将于 %s 到期，需要续期", files.ChainPath, leaf.NotAfter.Local().Format("2006-01-02 15:04"))
+		}
+	}
+
+	if swapRecords {
+		if e.aliyunAK == "" || e.aliyunSK == "" {
+			return fail(2, "缺少阿里云凭证：请设置 ALICLOUD_ACCESS_KEY_ID 和 ALICLOUD_ACCESS_KEY_SECRET")
+		}
+		aliyun, err := e.aliyunDNS()
+		if err != nil {
+			return fail(1, "初始化阿里云DNS客户端失败：", err)
+		}
+		records, err := aliyun.ListRecords(ctx, j.Domain)
+		if err != nil {
+			return fail(1, "查询云解析记录失败：", err)
+		}
+		a := dns.MatchRecord(records, j.RRA, j.Type, j.ValueA)
+		b := dns.MatchRecord(records, j.RRB, j.Type, j.ValueB)
+		if a == nil || b == nil {
+			return fail(3, "未找到 a 或 b 主机记录，请检查 --rr-a/--rr-b 与记录类型/记录值")
+		}
+		p.step("暂停记录 %s（RecordId %s，%s %s，当前状态 %s）", rrA, a.ID, a.Type, a.Value, a.Status)
+		p.step("启用记录 %s（RecordId %s，%s %s，当前状态 %s）", rrB, b.ID, b.Type, b.Value, b.Status)
+	}
+
+	hosts := verifyHosts(j)
+
+	if !config.On(j.QiniuOnly) {
+		switch j.Renewer {
+		case config.RenewerACME:
+			names := acmeNames(j)
+			p.step("通过 ACME（%s）签发 %s，验证方式 %s", e.acme.Directory, strings.Join(names, ","), j.ACMEChallenge)
+			if dns01 {
+				p.step("在 %s 添加 _acme-challenge TXT 记录，验证后删除", j.Domain)
+			} else {
+				p.step("在 %s/.well-known/acme-challenge 写入验证文件，验证后删除", j.ACMEWebroot)
+			}
+			p.step("证书写入 %s/%s", j.CertbotLive, names[0])
+		case config.RenewerCertbot:
+			p.step("执行 certbot renew")
+		}
+	}
+
+	files, err := certSource(j, e).Locate()
+	if err != nil {
+		return fail(1, "查找最新证书失败：", err)
+	}
+	bundle, err := loadBundle(j, files.KeyPath, files.ChainPath, hosts)
+	if bundle == nil {
+		return fail(1, "证书校验失败，拒绝部署：", err)
+	}
+	leaf := bundle.Leaf()
+	desc := fmt.Sprintf("，序列号 %s，到期 %s", leaf.SerialNumber.Text(16), leaf.NotAfter.Local().Format("2006-01-02 15:04"))
+	if !config.On(j.QiniuOnly) {
+		desc += "；续期后以届时最新的证书为准"
+	}
+	p.step("选用证书 私钥 %s，证书链 %s%s", files.KeyPath, files.ChainPath, desc)
+	switch {
+	case err == nil:
+		p.step("校验证书：私钥匹配、证书链可信、在有效期内且覆盖 %s", strings.Join(hosts, ","))
+	case config.On(j.QiniuOnly):
+		return fail(1, "证书校验失败，拒绝部署：", err)
+	default:
+		p.step("当前证书校验未通过（%v），续期后重新校验，未通过则不部署", err)
+	}
+
+	ds, err := newDeployers(j)
+	if err != nil {
+		return fail(2, err)
+	}
+	d := &deployment{job: j, env: e, files: files, bundle: bundle, run: &state.Run{}}
+	for _, dp := range ds {
+		pl, ok := dp.(planner)
+		if !ok {
+			p.step("部署到 %s", dp.Name())
+			continue
+		}
+		if err := pl.Plan(ctx, d, p); err != nil {
+			return fail(1, err)
+		}
+	}
+	if len(ds) > 1 {
+		p.step("任一目标部署或校验失败时，按相反顺序回滚已部署的目标")
+	}
+
+	if swapRecords {
+		p.step("恢复记录原状态 %s %s", rrA, rrB)
+	}
+	return nil
+}
@@ -0,0 +1,491 @@
+package main
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"auto-https/internal/certs"
+	"auto-https/internal/config"
+	"auto-https/internal/qiniu"
+	"auto-https/internal/tlscheck"
+)
+
+// runQiniu implements `rotate-cert qiniu certs list|prune`.
+func runQiniu(args []string) int {
+	if len(args) < 2 || args[0] != "certs" || (args[1] != "list" && args[1] != "prune") {
+		fmt.Fprintln(os.Stderr, "用法：rotate-cert qiniu certs list|prune [参数]")
+		return 2
+	}
+	action := args[1]
+	fs := flag.NewFlagSet("qiniu certs "+action, flag.ExitOnError)
+	var (
+		e      env
+		cn     string
+		keep   int
+		dryRun bool
+	)
+	fs.StringVar(&e.qiniuAK, "qiniu-ak", os.Getenv("QINIU_ACCESS_KEY"), "七牛AK（可用环境变量QINIU_ACCESS_KEY）")
+	fs.StringVar(&e.qiniuSK, "qiniu-sk", os.Getenv("QINIU_SECRET_KEY"), "七牛SK（可用环境变量QINIU_SECRET_KEY）")
+	fs.StringVar(&e.qiniuToken, "qiniu-token", qiniu.TokenAuto, "七牛鉴权模式：auto|v1|v2")
+	fs.StringVar(&cn, "cn", "", "只处理该通用名称（common name）的证书（可选）")
+	if action == "prune" {
+		fs.IntVar(&keep, "keep", 2, "每个通用名称保留最新的证书数量")
+		fs.BoolVar(&dryRun, "dry-run", false, "只列出将删除的证书，不删除")
+	}
+	addRetryFlags(fs, &e)
+	fs.Parse(args[2:])
+	if e.qiniuAK == "" || e.qiniuSK == "" {
+		fmt.Fprintln(os.Stderr, "缺少七牛AK/SK")
+		return 2
+	}
+
+	ctx := context.Background()
+	qn := e.qiniu()
+	if action == "prune" {
+		if _, err := pruneQiniuCerts(ctx, qn, cn, keep, dryRun); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		return 0
+	}
+
+	certList, err := qn.ListCerts(ctx)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "查询七牛证书失败：", err)
+		return 1
+	}
+	bound, err := qn.BoundDomains(ctx)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "查询七牛域名失败：", err)
+		return 1
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "CERTID\tNAME\tCN\tSANS\tEXPIRES\tBOUND")
+	for _, c := range certList {
+		if cn != "" && !strings.EqualFold(c.CommonName, cn) {
+			continue
+		}
+		expires := time.Unix(c.NotAfter, 0).Local().Format("2006-01-02")
+		if time.Now().Unix() > c.NotAfter {
+			expires += "(已过期)"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", c.CertID, c.Name, c.CommonName,
+			strings.Join(c.DNSNames, ","), expires, strings.Join(bound[c.CertID], ","))
+	}
+	w.Flush()
+	return 0
+}
+
+// pruneQiniuCerts deletes certificates superseded by at least keep newer ones
+// with the same common name and not bound to any domain. An empty cn covers
+// the whole account. It returns the number of certificates (to be) deleted.
+func pruneQiniuCerts(ctx context.Context, qn *qiniu.Client, cn string, keep int, dryRun bool) (int, error) {
+	certList, err := qn.ListCerts(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("查询七牛证书失败：%w", err)
+	}
+	if cn != "" {
+		filtered := certList[:0]
+		for _, c := range certList {
+			if strings.EqualFold(c.CommonName, cn) {
+				filtered = append(filtered, c)
+			}
+		}
+		certList = filtered
+	}
+	bound, err := qn.BoundDomains(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("查询七牛域名失败：%w", err)
+	}
+	stale := qiniu.Superseded(certList, bound, keep)
+	if len(stale) == 0 {
+		fmt.Println("没有需要清理的七牛证书")
+		return 0, nil
+	}
+	var failed []string
+	for _, c := range stale {
+		desc := fmt.Sprintf("%s（%s，CN %s，到期 %s）", c.CertID, c.Name, c.CommonName, time.Unix(c.NotAfter, 0).Local().Format("2006-01-02"))
+		if dryRun {
+			fmt.Println("[dry-run] 将删除七牛证书", desc)
+			continue
+		}
+		if err := qn.DeleteCert(ctx, c.CertID); err != nil {
+			fmt.Fprintln(os.Stderr, "删除七牛证书失败：", desc, err)
+			failed = append(failed, c.CertID)
+			continue
+		}
+		fmt.Println("已删除七牛证书", desc)
+	}
+	if len(failed) > 0 {
+		return len(stale) - len(failed), fmt.Errorf("删除七牛证书失败：%s", strings.Join(failed, ","))
+	}
+	return len(stale), nil
+}
+
+// qiniuSync is what is left to do so that every domain serves the local
+// certificate.
+type qiniuSync struct {
+	current []string
+	pending []string
+	// confs holds the HTTPS settings read for each domain.
+	confs map[string]qiniu.HTTPSConf
+	// reuseID is an already uploaded certificate with the local fingerprint.
+	reuseID string
+}
+
+// checkQiniuSync compares the certificate bound to each domain with leaf and
+// looks for an uploaded copy of leaf that can be bound without uploading.
+func checkQiniuSync(ctx context.Context, qn *qiniu.Client, leaf *x509.Certificate, domains []string) *qiniuSync {
+	want := certs.Fingerprint(leaf)
+	fingerprints := map[string]string{}
+	fingerprintOf := func(certID string) string {
+		if fp, ok := fingerprints[certID]; ok {
+			return fp
+		}
+		fp := ""
+		if detail, err := qn.GetCert(ctx, certID); err == nil {
+			if chain, err := certs.ParseChain([]byte(detail.CA)); err == nil {
+				fp = certs.Fingerprint(chain[0])
+			}
+		}
+		fingerprints[certID] = fp
+		return fp
+	}
+
+	s := &qiniuSync{confs: map[string]qiniu.HTTPSConf{}}
+	for _, d := range domains {
+		detail, err := qn.GetDomain(ctx, d)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "查询七牛域名配置失败：", d, err)
+			s.pending = append(s.pending, d)
+			continue
+		}
+		s.confs[d] = detail.HTTPS
+		if id := detail.HTTPS.CertID; id != "" && fingerprintOf(id) == want {
+			s.current = append(s.current, d)
+			if s.reuseID == "" {
+				s.reuseID = id
+			}
+			continue
+		}
+		s.pending = append(s.pending, d)
+	}
+	if len(s.pending) == 0 || s.reuseID != "" {
+		return s
+	}
+	list, err := qn.ListCerts(ctx)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "查询七牛证书失败：", err)
+		return s
+	}
+	for _, c := range list {
+		if c.NotAfter != leaf.NotAfter.Unix() {
+			continue
+		}
+		if fingerprintOf(c.CertID) == want {
+			s.reuseID = c.CertID
+			break
+		}
+	}
+	return s
+}
+
+// rebindConf keeps the domain's current HTTPS settings, swapping in certID and
+// applying the job's overrides. It also describes every changed field.
+func rebindConf(cur qiniu.HTTPSConf, certID string, forceHTTPS, http2 *bool) (qiniu.HTTPSConf, []string) {
+	next := cur
+	next.CertID = certID
+	if forceHTTPS != nil {
+		next.ForceHTTPS = *forceHTTPS
+	}
+	if http2 != nil {
+		next.HTTP2Enable = *http2
+	}
+	var diff []string
+	if cur.CertID != next.CertID {
+		diff = append(diff, fmt.Sprintf("certId: %q -> %q", cur.CertID, next.CertID))
+	}
+	if cur.ForceHTTPS != next.ForceHTTPS {
+		diff = append(diff, fmt.Sprintf("forceHttps: %v -> %v", cur.ForceHTTPS, next.ForceHTTPS))
+	}
+	if cur.HTTP2Enable != next.HTTP2Enable {
+		diff = append(diff, fmt.Sprintf("http2Enable: %v -> %v", cur.HTTP2Enable, next.HTTP2Enable))
+	}
+	return next, diff
+}
+
+// qiniuTargets returns the explicit domains plus, when matchSANs is set,
+// every CDN domain in the account that leaf is valid for.
+func qiniuTargets(ctx context.Context, qn *qiniu.Client, leaf *x509.Certificate, explicit []string, matchSANs bool) ([]string, error) {
+	targets := append([]string{}, explicit...)
+	if !matchSANs {
+		return targets, nil
+	}
+	seen := map[string]bool{}
+	for _, d := range targets {
+		seen[strings.ToLower(d)] = true
+	}
+	domains, err := qn.ListDomains(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, d := range domains {
+		name := strings.ToLower(d.Name)
+		if seen[name] || strings.HasPrefix(name, ".") || !certs.Covers(leaf, name) {
+			continue
+		}
+		seen[name] = true
+		targets = append(targets, d.Name)
+	}
+	return targets, nil
+}
+
+// verifyQiniuDomain waits until Qiniu reports the domain change as applied
+// and the CDN presents the certificate with the given fingerprint.
+func verifyQiniuDomain(ctx context.Context, qn *qiniu.Client, domain, fingerprint string, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	if err := qn.WaitDomainReady(ctx, domain, 10*time.Second); err != nil {
+		return err
+	}
+	return tlscheck.WaitFor(ctx, net.JoinHostPort(domain, "443"), domain, fingerprint, 15*time.Second)
+}
+
+// qiniuDeployer uploads the certificate (or reuses an identical upload) and
+// binds it to the job's Qiniu CDN domains.
+type qiniuDeployer struct {
+	name string
+	// optional deployers skip silently without credentials; this is the
+	// historical behaviour when no deploy list is configured.
+	optional bool
+
+	skip    bool
+	qn      *qiniu.Client
+	targets []string
+	qs      *qiniuSync
+	rebound []string
+	failed  []string
+}
+
+func (q *qiniuDeployer) Name() string { return q.name }
+
+func (q *qiniuDeployer) Prepare(ctx context.Context, d *deployment) error {
+	e, j, leaf := d.env, d.job, d.leaf()
+	if e.qiniuAK == "" || e.qiniuSK == "" {
+		if q.optional {
+			fmt.Fprintln(os.Stderr, "缺少七牛AK/SK，跳过证书上传与替换")
+			q.skip = true
+			return nil
+		}
+		return fmt.Errorf("缺少七牛AK/SK")
+	}
+	q.qn = e.qiniu()
+	q.targets = targetDomains(j)
+	if config.On(j.QiniuMatchSANs) {
+		targets, err := qiniuTargets(ctx, q.qn, leaf, j.QiniuDomains, true)
+		if err != nil {
+			return fmt.Errorf("查询七牛域名列表失败：%w", err)
+		}
+		fmt.Printf("证书 SAN（%s）覆盖的七牛域名：%s\n", strings.Join(leaf.DNSNames, ","), strings.Join(targets, ","))
+		if len(targets) == 0 {
+			return fmt.Errorf("七牛账户中没有被证书覆盖的域名")
+		}
+		q.targets = targets
+	}
+	q.qs = checkQiniuSync(ctx, q.qn, leaf, q.targets)
+	for _, dom := range q.qs.current {
+		fmt.Println("七牛 CDN 域名已使用当前证书，跳过：", dom)
+	}
+	return nil
+}
+
+func (q *qiniuDeployer) Deploy(ctx context.Context, d *deployment) error {
+	if q.skip {
+		return nil
+	}
+	j := d.job
+	if len(q.qs.pending) == 0 {
+		d.run.QiniuCertID = q.qs.reuseID
+		return nil
+	}
+	certID := q.qs.reuseID
+	if certID != "" {
+		fmt.Println("七牛已存在相同证书，直接复用，certID:", certID)
+	} else {
+		var err error
+		certID, err = q.qn.UploadCert(ctx, qiniu.UploadCertRequest{
+			Name:       fmt.Sprintf("%s-letsencrypt-%s", d.files.Name, time.Now().Format("20060102")),
+			CommonName: targetDomains(j)[0],
+			Pri:        string(d.bundle.KeyPEM),
+			CA:         string(d.bundle.ChainPEM),
+		})
+		if err != nil {
+			return fmt.Errorf("上传七牛证书失败：%w", err)
+		}
+		fmt.Println("七牛证书上传成功，certID:", certID)
+	}
+	d.run.QiniuCertID = certID
+	for _, cdnDomain := range q.qs.pending {
+		cur, ok := q.qs.confs[cdnDomain]
+		if !ok {
+			fmt.Fprintln(os.Stderr, "未读取到七牛域名当前 HTTPS 配置，跳过替换：", cdnDomain)
+			q.failed = append(q.failed, cdnDomain)
+			continue
+		}
+		conf, diff := rebindConf(cur, certID, j.QiniuForceHTTPS, j.QiniuHTTP2)
+		if err := q.qn.UpdateHTTPSConf(ctx, cdnDomain, conf); err != nil {
+			fmt.Fprintln(os.Stderr, "七牛域名证书替换失败：", cdnDomain, err)
+			q.failed = append(q.failed, cdnDomain)
+			continue
+		}
+		q.rebound = append(q.rebound, cdnDomain)
+		fmt.Println("已替换七牛 CDN 域名证书：", cdnDomain)
+		for _, line := range diff {
+			fmt.Println("  ", line)
+		}
+	}
+	if len(q.failed) > 0 {
+		q.summary()
+		return fmt.Errorf("七牛域名证书替换失败：%s", strings.Join(q.failed, ","))
+	}
+	return nil
+}
+
+func (q *qiniuDeployer) Verify(ctx context.Context, d *deployment) error {
+	if q.skip {
+		return nil
+	}
+	if timeout, _ := time.ParseDuration(d.job.QiniuVerifyTimeout); timeout > 0 {
+		fingerprint := certs.Fingerprint(d.leaf())
+		for _, cdnDomain := range q.rebound {
+			fmt.Println("等待七牛配置生效并校验线上证书：", cdnDomain)
+			if err := verifyQiniuDomain(ctx, q.qn, cdnDomain, fingerprint, timeout); err != nil {
+				fmt.Fprintln(os.Stderr, "七牛域名证书校验失败：", cdnDomain, err)
+				q.failed = append(q.failed, cdnDomain)
+				continue
+			}
+			fmt.Println("已确认七牛 CDN 使用新证书：", cdnDomain)
+		}
+	}
+	q.summary()
+	if len(q.failed) > 0 {
+		return fmt.Errorf("七牛域名证书替换失败：%s", strings.Join(q.failed, ","))
+	}
+	return nil
+}
+
+func (q *qiniuDeployer) summary() {
+	if len(q.targets) > 1 {
+		fmt.Printf("七牛域名证书替换：共 %d 个，已是最新 %d，成功 %d，失败 %d\n",
+			len(q.targets), len(q.qs.current), len(q.qs.pending)-len(q.failed), len(q.failed))
+	}
+}
+
+// Rollback binds the previous certificate, with the previous HTTPS switches,
+// to every domain this run rebound.
+func (q *qiniuDeployer) Rollback(ctx context.Context, d *deployment) error {
+	var errs []string
+	for _, cdnDomain := range q.rebound {
+		prev := q.qs.confs[cdnDomain]
+		if prev.CertID == "" {
+			fmt.Fprintln(os.Stderr, "七牛域名原先未配置证书，无法回滚：", cdnDomain)
+			continue
+		}
+		if err := q.qn.UpdateHTTPSConf(ctx, cdnDomain, prev); err != nil {
+			errs = append(errs, cdnDomain+"："+err.Error())
+			continue
+		}
+		fmt.Println("已恢复七牛 CDN 域名原证书：", cdnDomain, prev.CertID)
+	}
+	q.rebound = nil
+	if len(errs) > 0 {
+		return fmt.Errorf("%s", strings.Join(errs, "；"))
+	}
+	return nil
+}
+
+// Finish prunes superseded certificates; before every target succeeded the
+// previous certificate may still be needed for rollback.
+func (q *qiniuDeployer) Finish(ctx context.Context, d *deployment) error {
+	if q.skip || d.job.QiniuPruneKeep <= 0 {
+		return nil
+	}
+	_, err := pruneQiniuCerts(ctx, q.qn, targetDomains(d.job)[0], d.job.QiniuPruneKeep, false)
+	return err
+}
+
+func (q *qiniuDeployer) Plan(ctx context.Context, d *deployment, p *plan) error {
+	e, j, leaf := d.env, d.job, d.leaf()
+	if e.qiniuAK == "" || e.qiniuSK == "" {
+		if q.optional {
+			p.step("缺少七牛AK/SK，跳过证书上传与替换")
+			return nil
+		}
+		return fmt.Errorf("缺少七牛AK/SK")
+	}
+	cdnDomains := targetDomains(j)
+	certID, upload := "<上传返回的certID>", true
+	targets := cdnDomains
+	if config.On(j.QiniuMatchSANs) {
+		var err error
+		targets, err = qiniuTargets(ctx, e.qiniu(), leaf, j.QiniuDomains, true)
+		if err != nil {
+			return fmt.Errorf("查询七牛域名列表失败：%w", err)
+		}
+		p.step("证书 SAN（%s）覆盖的七牛域名：%s", strings.Join(leaf.DNSNames, ","), strings.Join(targets, ","))
+	}
+	qs := checkQiniuSync(ctx, e.qiniu(), leaf, targets)
+	pending := qs.pending
+	// the served certificate can only be compared when no renewal runs first
+	if config.On(j.QiniuOnly) {
+		for _, dom := range qs.current {
+			p.step("七牛 CDN 域名 %s 已使用当前证书，跳过", dom)
+		}
+		if qs.reuseID != "" {
+			certID, upload = qs.reuseID, false
+			if len(pending) > 0 {
+				p.step("七牛已存在相同证书 %s，直接复用，不再上传", certID)
+			}
+		}
+	} else {
+		pending = targets
+	}
+	if upload && len(pending) > 0 {
+		body, _ := json.Marshal(qiniu.UploadCertRequest{
+			Name:       fmt.Sprintf("%s-letsencrypt-%s", d.files.Name, time.Now().Format("20060102")),
+			CommonName: cdnDomains[0],
+			Pri:        fmt.Sprintf("<%s，%d 字节>", d.files.KeyPath, len(d.bundle.KeyPEM)),
+			CA:         fmt.Sprintf("<%s，%d 字节>", d.files.ChainPath, len(d.bundle.ChainPEM)),
+		})
+		p.step("上传证书到七牛：POST %s/sslcert %s", qiniu.DefaultAPIHost, body)
+	}
+	for _, cdnDomain := range pending {
+		cur, ok := qs.confs[cdnDomain]
+		if !ok {
+			p.step("未读取到七牛域名 %s 的当前 HTTPS 配置，将跳过替换", cdnDomain)
+			continue
+		}
+		conf, diff := rebindConf(cur, certID, j.QiniuForceHTTPS, j.QiniuHTTP2)
+		bind, _ := json.Marshal(conf)
+		p.step("为七牛 CDN 域名 %s 绑定新证书：PUT %s/domain/%s/httpsconf %s（变更：%s）",
+			cdnDomain, qiniu.DefaultAPIHost, cdnDomain, bind, strings.Join(diff, "；"))
+		if timeout, _ := time.ParseDuration(j.QiniuVerifyTimeout); timeout > 0 {
+			p.step("等待 %s 配置生效并通过 TLS 握手确认线上证书（超时 %s）", cdnDomain, j.QiniuVerifyTimeout)
+		}
+	}
+	if j.QiniuPruneKeep > 0 {
+		p.step("全部目标部署成功后，清理通用名称为 %s 的旧证书，保留最新 %d 个（按当前已有证书计算）：", cdnDomains[0], j.QiniuPruneKeep)
+		if _, err := pruneQiniuCerts(ctx, e.qiniu(), cdnDomains[0], j.QiniuPruneKeep, true); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+		}
+	}
+	return nil
+}
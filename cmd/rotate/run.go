@@ -0,0 +1,103 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"auto-https/internal/acme"
+	"auto-https/internal/config"
+	"auto-https/internal/dns"
+	"auto-https/internal/qiniu"
+)
+
+// runConfig implements `rotate-cert run --config <file>`: every job in the
+// file is executed in order and a per-job summary is printed at the end.
+func runConfig(args []string) int {
+	fs := flag.NewFlagSet("run", flag.ExitOnError)
+	var (
+		path  string
+		e     env
+		only  string
+		force bool
+	)
+	fs.StringVar(&path, "config", "./rotate.toml", "任务配置文件路径（TOML）")
+	fs.StringVar(&only, "job", "", "只执行指定名称的任务（可选）")
+	fs.BoolVar(&force, "force", false, "所有任务忽略证书到期检查强制执行")
+	fs.StringVar(&e.qiniuAK, "qiniu-ak", os.Getenv("QINIU_ACCESS_KEY"), "七牛AK（可用环境变量QINIU_ACCESS_KEY）")
+	fs.StringVar(&e.qiniuSK, "qiniu-sk", os.Getenv("QINIU_SECRET_KEY"), "七牛SK（可用环境变量QINIU_SECRET_KEY）")
+	fs.StringVar(&e.qiniuToken, "qiniu-token", qiniu.TokenAuto, "七牛鉴权模式：auto|v1|v2")
+	fs.BoolVar(&e.verbose, "verbose", false, "打印详细过程，例如每个候选证书被选用或排除的原因")
+	fs.IntVar(&e.pageSize, "page-size", dns.AliyunMaxPageSize, "查询解析记录时每页条数，最大500")
+	addRetryFlags(fs, &e)
+	fs.BoolVar(&e.dryRun, "dry-run", false, "只打印每个任务的执行计划，不做任何修改")
+	fs.Parse(args)
+
+	cfg, err := loadConfig(path, &e)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+
+	watchSignals()
+	type result struct {
+		name string
+		err  error
+	}
+	var results []result
+	for i := range cfg.Jobs {
+		j := &cfg.Jobs[i]
+		if only != "" && j.Name != only {
+			continue
+		}
+		if force {
+			j.Force = config.Bool(true)
+		}
+		fmt.Printf("==== 任务 %s ====\n", j.Name)
+		err := runJob(j, &e)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+		}
+		results = append(results, result{name: j.Name, err: err})
+	}
+	if len(results) == 0 {
+		fmt.Fprintln(os.Stderr, "没有匹配的任务：", only)
+		return 2
+	}
+
+	failed := 0
+	fmt.Println("==== 执行结果 ====")
+	for _, r := range results {
+		if r.err != nil {
+			failed++
+			fmt.Printf("%-30s 失败：%v\n", r.name, r.err)
+		} else {
+			fmt.Printf("%-30s 成功\n", r.name)
+		}
+	}
+	fmt.Printf("共 %d 个任务，成功 %d，失败 %d\n", len(results), len(results)-failed, failed)
+	if failed > 0 {
+		return 1
+	}
+	return 0
+}
+
+// loadConfig reads the job file and completes e with the settings shared by
+// `run` and `daemon`.
+func loadConfig(path string, e *env) (*config.Config, error) {
+	cfg, err := config.Load(path)
+	if err != nil {
+		return nil, fmt.Errorf("读取配置文件失败：%w", err)
+	}
+	if e.pageSize < 1 || e.pageSize > dns.AliyunMaxPageSize {
+		return nil, fmt.Errorf("--page-size 取值范围为 1-500")
+	}
+	if e.retries < 0 || e.timeout < 0 {
+		return nil, fmt.Errorf("--retries 与 --timeout 不能为负数")
+	}
+	cfg.ACME.ApplyDefaults(acme.LetsEncryptURL)
+	e.acme = cfg.ACME
+	e.aliyunAK = os.Getenv("ALICLOUD_ACCESS_KEY_ID")
+	e.aliyunSK = os.Getenv("ALICLOUD_ACCESS_KEY_SECRET")
+	return cfg, nil
+}
@@ -0,0 +1,248 @@
+package acme
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	xacme "golang.org/x/crypto/acme"
+
+	"auto-https/internal/retry"
+)
+
+const LetsEncryptURL = xacme.LetsEncryptURL
+
+type Client struct {
+	// DirectoryURL is the ACME directory, e.g. LetsEncryptURL or a local Pebble.
+	DirectoryURL string
+	// AccountKeyPath holds the PEM encoded account key; it is created on first use.
+	AccountKeyPath string
+	Email          string
+	HTTPClient     *http.Client
+	// Retry shapes the backoff x/crypto/acme uses for 5xx, 429 and badNonce
+	// answers; the zero value keeps the library default.
+	Retry retry.Policy
+
+	client *xacme.Client
+}
+
+// Certificate is the result of a successful order.
+type Certificate struct {
+	Names      []string
+	PrivateKey []byte
+	Cert       []byte
+	Chain      []byte
+	Fullchain  []byte
+	Leaf       *x509.Certificate
+}
+
+// Register loads the account key (creating it if missing) and makes sure the
+// account exists on the server.
+func (c *Client) Register(ctx context.Context) error {
+	key, err := loadOrCreateKey(c.AccountKeyPath)
+	if err != nil {
+		return fmt.Errorf("acme account key: %w", err)
+	}
+	c.client = &xacme.Client{
+		Key:          key,
+		DirectoryURL: c.DirectoryURL,
+		HTTPClient:   c.HTTPClient,
+		UserAgent:    "auto-https",
+	}
+	if c.Retry.Attempts > 0 {
+		c.client.RetryBackoff = c.retryBackoff
+	}
+	acct := &xacme.Account{}
+	if c.Email != "" {
+		acct.Contact = []string{"mailto:" + c.Email}
+	}
+	_, err = c.client.Register(ctx, acct, xacme.AcceptTOS)
+	if err != nil && !errors.Is(err, xacme.ErrAccountAlreadyExists) {
+		return fmt.Errorf("acme register: %w", err)
+	}
+	return nil
+}
+
+func (c *Client) retryBackoff(n int, req *http.Request, resp *http.Response) time.Duration {
+	if n >= c.Retry.Attempts {
+		return -1
+	}
+	wait := c.Retry.Backoff(n)
+	if c.Retry.OnRetry != nil && resp != nil {
+		c.Retry.OnRetry("acme "+req.Method+" "+req.URL.Path, n, fmt.Errorf("http %d", resp.StatusCode), wait)
+	}
+	return wait
+}
+
+// Obtain orders a certificate for names, solving each authorization with solver.
+func (c *Client) Obtain(ctx context.Context, names []string, solver Solver) (*Certificate, error) {
+	if c.client == nil {
+		if err := c.Register(ctx); err != nil {
+			return nil, err
+		}
+	}
+	if len(names) == 0 {
+		return nil, errors.New("acme: no names to order")
+	}
+	order, err := c.client.AuthorizeOrder(ctx, xacme.DomainIDs(names...))
+	if err != nil {
+		return nil, fmt.Errorf("acme new order: %w", err)
+	}
+	for _, u := range order.AuthzURLs {
+		if err := c.authorize(ctx, u, solver); err != nil {
+			return nil, err
+		}
+	}
+	orderURL := order.URI
+	order, err = c.client.WaitOrder(ctx, orderURL)
+	if err != nil {
+		return nil, fmt.Errorf("acme wait order: %w", err)
+	}
+
+	certKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	csr, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject:  pkix.Name{CommonName: names[0]},
+		DNSNames: names,
+	}, certKey)
+	if err != nil {
+		return nil, err
+	}
+	der, err := c.finalize(ctx, orderURL, order.FinalizeURL, csr)
+	if err != nil {
+		return nil, fmt.Errorf("acme finalize: %w", err)
+	}
+	if len(der) == 0 {
+		return nil, errors.New("acme: empty certificate chain")
+	}
+	leaf, err := x509.ParseCertificate(der[0])
+	if err != nil {
+		return nil, fmt.Errorf("acme: parse leaf: %w", err)
+	}
+	keyPEM, err := encodeKey(certKey)
+	if err != nil {
+		return nil, err
+	}
+	out := &Certificate{Names: names, PrivateKey: keyPEM, Leaf: leaf}
+	out.Cert = pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der[0]})
+	for _, b := range der[1:] {
+		out.Chain = append(out.Chain, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: b})...)
+	}
+	out.Fullchain = append(append([]byte{}, out.Cert...), out.Chain...)
+	return out, nil
+}
+
+// finalize submits the CSR and downloads the chain. x/crypto/acme waits for
+// an order still processing at the Location of the finalize response, which
+// servers finalizing asynchronously (Pebble) leave out; the order is then
+// polled at its own URL instead.
+func (c *Client) finalize(ctx context.Context, orderURL, finalizeURL string, csr []byte) ([][]byte, error) {
+	der, _, err := c.client.CreateOrderCert(ctx, finalizeURL, csr, true)
+	if err == nil {
+		return der, nil
+	}
+	order, werr := c.client.WaitOrder(ctx, orderURL)
+	if werr != nil || order.Status != xacme.StatusValid || order.CertURL == "" {
+		return nil, err
+	}
+	return c.client.FetchCert(ctx, order.CertURL, true)
+}
+
+func (c *Client) authorize(ctx context.Context, authzURL string, solver Solver) error {
+	authz, err := c.client.GetAuthorization(ctx, authzURL)
+	if err != nil {
+		return fmt.Errorf("acme authorization: %w", err)
+	}
+	if authz.Status == xacme.StatusValid {
+		return nil
+	}
+	var chal *xacme.Challenge
+	for _, ch := range authz.Challenges {
+		if ch.Type == solver.Type() {
+			chal = ch
+			break
+		}
+	}
+	domain := authz.Identifier.Value
+	if chal == nil {
+		return fmt.Errorf("acme: no %s challenge offered for %s", solver.Type(), domain)
+	}
+	keyAuth, err := c.keyAuthorization(chal)
+	if err != nil {
+		return err
+	}
+	// a failed Present may still have left something behind, such as a TXT
+	// record that did not propagate in time
+	err = solver.Present(ctx, domain, chal.Token, keyAuth)
+	defer solver.CleanUp(ctx, domain, chal.Token, keyAuth)
+	if err != nil {
+		return fmt.Errorf("acme present %s: %w", domain, err)
+	}
+	if _, err := c.client.Accept(ctx, chal); err != nil {
+		return fmt.Errorf("acme accept %s: %w", domain, err)
+	}
+	if _, err := c.client.WaitAuthorization(ctx, authz.URI); err != nil {
+		return fmt.Errorf("acme validate %s: %w", domain, err)
+	}
+	return nil
+}
+
+func (c *Client) keyAuthorization(chal *xacme.Challenge) (string, error) {
+	switch chal.Type {
+	case "http-01":
+		return c.client.HTTP01ChallengeResponse(chal.Token)
+	case "dns-01":
+		return c.client.DNS01ChallengeRecord(chal.Token)
+	}
+	return "", fmt.Errorf("acme: unsupported challenge type %s", chal.Type)
+}
+
+func loadOrCreateKey(path string) (crypto.Signer, error) {
+	b, err := os.ReadFile(path)
+	if err == nil {
+		block, _ := pem.Decode(b)
+		if block == nil {
+			return nil, fmt.Errorf("no PEM data in %s", path)
+		}
+		return x509.ParseECPrivateKey(block.Bytes)
+	}
+	if !os.IsNotExist(err) {
+		return nil, err
+	}
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	keyPEM, err := encodeKey(key)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(path, keyPEM, 0o600); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+func encodeKey(key *ecdsa.PrivateKey) ([]byte, error) {
+	der, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der}), nil
+}
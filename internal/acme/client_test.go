@@ -0,0 +1,252 @@
+package acme
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeACME is a minimal RFC 8555 server for one order of one name solved
+// with http-01. JWS signatures are not checked; payloads are only decoded.
+type fakeACME struct {
+	t   *testing.T
+	srv *httptest.Server
+	// webroot is where the challenge file must be when the challenge is
+	// accepted.
+	webroot string
+	// async answers finalize with "processing" and no Location header, as
+	// Pebble does, leaving the client to poll the order.
+	async bool
+
+	mu        sync.Mutex
+	name      string
+	authzDone bool
+	issued    []byte
+	finalized bool
+	caKey     *ecdsa.PrivateKey
+	caCert    *x509.Certificate
+}
+
+func newFakeACME(t *testing.T, webroot string, async bool) *fakeACME {
+	f := &fakeACME{t: t, webroot: webroot, async: async}
+	var err error
+	if f.caKey, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader); err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "fake ACME CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(24 * time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &f.caKey.PublicKey, f.caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.caCert, err = x509.ParseCertificate(der); err != nil {
+		t.Fatal(err)
+	}
+	f.srv = httptest.NewServer(http.HandlerFunc(f.serve))
+	t.Cleanup(f.srv.Close)
+	return f
+}
+
+func (f *fakeACME) url(path string) string { return f.srv.URL + path }
+
+func (f *fakeACME) serve(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Replay-Nonce", "nonce")
+	if r.URL.Path == "/dir" {
+		f.json(w, http.StatusOK, map[string]string{
+			"newNonce":   f.url("/nonce"),
+			"newAccount": f.url("/account"),
+			"newOrder":   f.url("/order"),
+		})
+		return
+	}
+	if r.URL.Path == "/nonce" {
+		return
+	}
+	var jws struct{ Payload string }
+	if err := json.NewDecoder(r.Body).Decode(&jws); err != nil {
+		f.t.Errorf("%s: body is not JWS: %v", r.URL.Path, err)
+		return
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(jws.Payload)
+	if err != nil {
+		f.t.Errorf("%s: payload: %v", r.URL.Path, err)
+		return
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	switch r.URL.Path {
+	case "/account":
+		w.Header().Set("Location", f.url("/account/1"))
+		f.json(w, http.StatusCreated, map[string]string{"status": "valid"})
+	case "/order":
+		var req struct {
+			Identifiers []struct{ Value string }
+		}
+		json.Unmarshal(payload, &req)
+		f.name = req.Identifiers[0].Value
+		w.Header().Set("Location", f.url("/order/1"))
+		f.json(w, http.StatusCreated, f.order())
+	case "/order/1":
+		f.json(w, http.StatusOK, f.order())
+	case "/authz/1":
+		status := "pending"
+		if f.authzDone {
+			status = "valid"
+		}
+		f.json(w, http.StatusOK, map[string]any{
+			"status":     status,
+			"identifier": map[string]string{"type": "dns", "value": f.name},
+			"challenges": []map[string]string{
+				{"type": "dns-01", "url": f.url("/chal/dns"), "token": "dnstoken", "status": "pending"},
+				{"type": "http-01", "url": f.url("/chal/1"), "token": "httptoken", "status": "pending"},
+			},
+		})
+	case "/chal/1":
+		b, err := os.ReadFile(filepath.Join(f.webroot, ".well-known", "acme-challenge", "httptoken"))
+		if err != nil || !strings.HasPrefix(string(b), "httptoken.") {
+			f.t.Errorf("challenge accepted without the key authorization in place: %q, %v", b, err)
+		}
+		f.authzDone = true
+		f.json(w, http.StatusOK, map[string]string{"type": "http-01", "url": f.url("/chal/1"), "token": "httptoken", "status": "valid"})
+	case "/finalize/1":
+		var req struct{ CSR string }
+		json.Unmarshal(payload, &req)
+		f.issue(req.CSR)
+		if f.async {
+			f.json(w, http.StatusOK, map[string]any{"status": "processing", "finalize": f.url("/finalize/1")})
+			f.finalized = true
+			return
+		}
+		f.finalized = true
+		w.Header().Set("Location", f.url("/order/1"))
+		f.json(w, http.StatusOK, f.order())
+	case "/cert/1":
+		w.Header().Set("Content-Type", "application/pem-certificate-chain")
+		w.Write(f.issued)
+		w.Write(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: f.caCert.Raw}))
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (f *fakeACME) order() map[string]any {
+	o := map[string]any{
+		"status":         "pending",
+		"identifiers":    []map[string]string{{"type": "dns", "value": f.name}},
+		"authorizations": []string{f.url("/authz/1")},
+		"finalize":       f.url("/finalize/1"),
+	}
+	switch {
+	case f.finalized:
+		o["status"] = "valid"
+		o["certificate"] = f.url("/cert/1")
+	case f.authzDone:
+		o["status"] = "ready"
+	}
+	return o
+}
+
+func (f *fakeACME) issue(csrB64 string) {
+	der, err := base64.RawURLEncoding.DecodeString(csrB64)
+	if err != nil {
+		f.t.Fatalf("csr: %v", err)
+	}
+	csr, err := x509.ParseCertificateRequest(der)
+	if err != nil {
+		f.t.Fatalf("csr: %v", err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      csr.Subject,
+		DNSNames:     csr.DNSNames,
+		NotBefore:    time.Now().Add(-time.Minute),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	leaf, err := x509.CreateCertificate(rand.Reader, tmpl, f.caCert, csr.PublicKey, f.caKey)
+	if err != nil {
+		f.t.Fatalf("issue: %v", err)
+	}
+	f.issued = pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: leaf})
+}
+
+func (f *fakeACME) json(w http.ResponseWriter, code int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(v)
+}
+
+func TestObtain(t *testing.T) {
+	for _, async := range []bool{false, true} {
+		webroot := t.TempDir()
+		f := newFakeACME(t, webroot, async)
+		c := &Client{
+			DirectoryURL:   f.url("/dir"),
+			AccountKeyPath: filepath.Join(t.TempDir(), "account.key"),
+			HTTPClient:     f.srv.Client(),
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		cert, err := c.Obtain(ctx, []string{"www.example.com"}, &WebrootSolver{Root: webroot})
+		cancel()
+		if err != nil {
+			t.Fatalf("async=%v: %v", async, err)
+		}
+		if err := cert.Leaf.VerifyHostname("www.example.com"); err != nil {
+			t.Errorf("async=%v: %v", async, err)
+		}
+		if !strings.Contains(string(cert.Chain), "CERTIFICATE") || !strings.HasPrefix(string(cert.Fullchain), string(cert.Cert)) {
+			t.Errorf("async=%v: chain %q, fullchain %q", async, cert.Chain, cert.Fullchain)
+		}
+		if _, err := os.Stat(filepath.Join(webroot, ".well-known", "acme-challenge", "httptoken")); !os.IsNotExist(err) {
+			t.Errorf("async=%v: challenge file left behind: %v", async, err)
+		}
+		if _, err := os.Stat(c.AccountKeyPath); err != nil {
+			t.Errorf("async=%v: account key not saved: %v", async, err)
+		}
+	}
+}
+
+func TestObtainNoMatchingChallenge(t *testing.T) {
+	f := newFakeACME(t, t.TempDir(), false)
+	c := &Client{
+		DirectoryURL:   f.url("/dir"),
+		AccountKeyPath: filepath.Join(t.TempDir(), "account.key"),
+		HTTPClient:     f.srv.Client(),
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	_, err := c.Obtain(ctx, []string{"www.example.com"}, &fakeSolver{typ: "tls-alpn-01"})
+	if err == nil || !strings.Contains(err.Error(), "no tls-alpn-01 challenge") {
+		t.Fatalf("error = %v", err)
+	}
+}
+
+type fakeSolver struct{ typ string }
+
+func (s *fakeSolver) Type() string { return s.typ }
+
+func (s *fakeSolver) Present(ctx context.Context, domain, token, keyAuth string) error { return nil }
+
+func (s *fakeSolver) CleanUp(ctx context.Context, domain, token, keyAuth string) error { return nil }
@@ -0,0 +1,114 @@
+package acme
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"auto-https/internal/dns"
+)
+
+// DNS01Solver answers dns-01 challenges by adding an _acme-challenge TXT
+// record through a dns.Provider and removing it once validation is done.
+type DNS01Solver struct {
+	Provider dns.Provider
+	// Zone is the domain managed by the provider, e.g. example.com.
+	Zone string
+	TTL  int64
+	// Nameserver, if set (host:port), is queried instead of the system
+	// resolver when waiting for the record to propagate.
+	Nameserver         string
+	PropagationTimeout time.Duration
+	PollInterval       time.Duration
+
+	mu      sync.Mutex
+	records map[string]string
+}
+
+func (s *DNS01Solver) Type() string { return "dns-01" }
+
+func (s *DNS01Solver) Present(ctx context.Context, domain, token, keyAuth string) error {
+	fqdn := "_acme-challenge." + strings.TrimPrefix(domain, "*.")
+	rr, err := relativeName(fqdn, s.Zone)
+	if err != nil {
+		return err
+	}
+	ttl := s.TTL
+	if ttl <= 0 {
+		ttl = 600
+	}
+	id, err := s.Provider.AddRecord(ctx, s.Zone, dns.Record{RR: rr, Type: "TXT", Value: keyAuth, TTL: ttl})
+	if err != nil {
+		return fmt.Errorf("add TXT %s: %w", fqdn, err)
+	}
+	s.mu.Lock()
+	if s.records == nil {
+		s.records = make(map[string]string)
+	}
+	s.records[token] = id
+	s.mu.Unlock()
+	return s.waitPropagation(ctx, fqdn, keyAuth)
+}
+
+func (s *DNS01Solver) CleanUp(ctx context.Context, domain, token, keyAuth string) error {
+	s.mu.Lock()
+	id, ok := s.records[token]
+	delete(s.records, token)
+	s.mu.Unlock()
+	if !ok || id == "" {
+		return nil
+	}
+	return s.Provider.DeleteRecord(ctx, id)
+}
+
+func (s *DNS01Solver) waitPropagation(ctx context.Context, fqdn, value string) error {
+	timeout := s.PropagationTimeout
+	if timeout <= 0 {
+		timeout = 5 * time.Minute
+	}
+	interval := s.PollInterval
+	if interval <= 0 {
+		interval = 10 * time.Second
+	}
+	resolver := net.DefaultResolver
+	if s.Nameserver != "" {
+		resolver = &net.Resolver{
+			PreferGo: true,
+			Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, network, s.Nameserver)
+			},
+		}
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	for {
+		txts, _ := resolver.LookupTXT(ctx, fqdn)
+		for _, t := range txts {
+			if t == value {
+				return nil
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("TXT %s not visible after %s", fqdn, timeout)
+		case <-time.After(interval):
+		}
+	}
+}
+
+// relativeName turns fqdn into the host record (RR) inside zone.
+func relativeName(fqdn, zone string) (string, error) {
+	fqdn = strings.TrimSuffix(strings.ToLower(fqdn), ".")
+	zone = strings.TrimSuffix(strings.ToLower(zone), ".")
+	if fqdn == zone {
+		return "@", nil
+	}
+	if !strings.HasSuffix(fqdn, "."+zone) {
+		return "", fmt.Errorf("%s is not inside zone %s", fqdn, zone)
+	}
+	return strings.TrimSuffix(fqdn, "."+zone), nil
+}
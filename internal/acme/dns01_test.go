@@ -0,0 +1,76 @@
+package acme
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"auto-https/internal/dns"
+)
+
+// fakeProvider keeps records in memory; only Add and Delete are used by the
+// solver.
+type fakeProvider struct {
+	dns.Provider
+	records map[string]dns.Record
+}
+
+func (p *fakeProvider) AddRecord(ctx context.Context, domain string, r dns.Record) (string, error) {
+	id := r.RR + "-id"
+	p.records[id] = r
+	return id, nil
+}
+
+func (p *fakeProvider) DeleteRecord(ctx context.Context, id string) error {
+	delete(p.records, id)
+	return nil
+}
+
+func TestDNS01CleanUpAfterPropagationTimeout(t *testing.T) {
+	// a nameserver that never answers
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	p := &fakeProvider{records: map[string]dns.Record{}}
+	s := &DNS01Solver{
+		Provider:           p,
+		Zone:               "example.com",
+		Nameserver:         conn.LocalAddr().String(),
+		PropagationTimeout: 200 * time.Millisecond,
+		PollInterval:       50 * time.Millisecond,
+	}
+	ctx := context.Background()
+	if err := s.Present(ctx, "*.www.example.com", "tok", "digest"); err == nil {
+		t.Fatal("Present succeeded without the record being visible")
+	}
+	r, ok := p.records["_acme-challenge.www-id"]
+	if !ok || r.Type != "TXT" || r.Value != "digest" {
+		t.Fatalf("records after Present = %+v", p.records)
+	}
+	if err := s.CleanUp(ctx, "*.www.example.com", "tok", "digest"); err != nil {
+		t.Fatal(err)
+	}
+	if len(p.records) != 0 {
+		t.Errorf("records left after CleanUp: %+v", p.records)
+	}
+}
+
+func TestRelativeName(t *testing.T) {
+	for _, c := range []struct{ fqdn, zone, want string }{
+		{"_acme-challenge.example.com", "example.com", "_acme-challenge"},
+		{"_acme-challenge.a.b.Example.com.", "example.com", "_acme-challenge.a.b"},
+		{"example.com", "example.com.", "@"},
+	} {
+		got, err := relativeName(c.fqdn, c.zone)
+		if err != nil || got != c.want {
+			t.Errorf("relativeName(%q, %q) = %q, %v; want %q", c.fqdn, c.zone, got, err, c.want)
+		}
+	}
+	if _, err := relativeName("_acme-challenge.example.org", "example.com"); err == nil {
+		t.Error("name outside the zone accepted")
+	}
+}
@@ -0,0 +1,90 @@
+package acme
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// TestPebble orders a certificate from a local Pebble server. It only runs
+// when ACME_PEBBLE_DIRECTORY is set, e.g.
+//
+//	pebble -config test/config/pebble-config.json -dnsserver 127.0.0.1:8053 &
+//	pebble-challtestsrv -http01 "" -https01 "" -tlsalpn01 "" &
+//	ACME_PEBBLE_DIRECTORY=https://localhost:14000/dir \
+//	ACME_PEBBLE_CA=$PEBBLE/test/certs/pebble.minica.pem go test ./internal/acme -run Pebble
+//
+// The http-01 answers are served on ACME_PEBBLE_HTTP_ADDR (default :5002,
+// Pebble's httpPort) and the name ordered is ACME_PEBBLE_DOMAIN (default
+// example.test, which pebble-challtestsrv resolves to 127.0.0.1).
+func TestPebble(t *testing.T) {
+	dir := os.Getenv("ACME_PEBBLE_DIRECTORY")
+	if dir == "" {
+		t.Skip("ACME_PEBBLE_DIRECTORY not set")
+	}
+	domain := envOr("ACME_PEBBLE_DOMAIN", "example.test")
+
+	tlsConfig := &tls.Config{InsecureSkipVerify: true}
+	if ca := os.Getenv("ACME_PEBBLE_CA"); ca != "" {
+		b, err := os.ReadFile(ca)
+		if err != nil {
+			t.Fatal(err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(b) {
+			t.Fatalf("no certificates in %s", ca)
+		}
+		tlsConfig = &tls.Config{RootCAs: pool}
+	}
+
+	webroot := t.TempDir()
+	srv := &http.Server{Addr: envOr("ACME_PEBBLE_HTTP_ADDR", ":5002"), Handler: http.FileServer(http.Dir(webroot))}
+	go srv.ListenAndServe()
+	t.Cleanup(func() { srv.Close() })
+
+	tmp := t.TempDir()
+	client := &Client{
+		DirectoryURL:   dir,
+		AccountKeyPath: filepath.Join(tmp, "account.key"),
+		Email:          "admin@" + domain,
+		HTTPClient:     &http.Client{Timeout: 30 * time.Second, Transport: &http.Transport{TLSClientConfig: tlsConfig}},
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
+	cert, err := client.Obtain(ctx, []string{domain}, &WebrootSolver{Root: webroot})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cert.Leaf.VerifyHostname(domain); err != nil {
+		t.Errorf("leaf does not cover %s: %v", domain, err)
+	}
+	if len(cert.Chain) == 0 {
+		t.Error("empty chain")
+	}
+
+	// the account key is reused on the next run
+	again := &Client{DirectoryURL: dir, AccountKeyPath: client.AccountKeyPath, HTTPClient: client.HTTPClient}
+	if err := again.Register(ctx); err != nil {
+		t.Fatalf("register with existing key: %v", err)
+	}
+
+	_, full, err := Save(filepath.Join(tmp, "live", domain), cert)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(full); err != nil {
+		t.Error(err)
+	}
+}
+
+func envOr(key, def string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return def
+}
@@ -0,0 +1,34 @@
+package acme
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+)
+
+// Solver fulfils one challenge type for an authorization.
+type Solver interface {
+	Type() string
+	Present(ctx context.Context, domain, token, keyAuth string) error
+	CleanUp(ctx context.Context, domain, token, keyAuth string) error
+}
+
+// WebrootSolver answers http-01 challenges by writing the key authorization
+// under <Root>/.well-known/acme-challenge, which the web server must serve.
+type WebrootSolver struct {
+	Root string
+}
+
+func (s *WebrootSolver) Type() string { return "http-01" }
+
+func (s *WebrootSolver) Present(ctx context.Context, domain, token, keyAuth string) error {
+	dir := filepath.Join(s.Root, ".well-known", "acme-challenge")
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, token), []byte(keyAuth), 0o644)
+}
+
+func (s *WebrootSolver) CleanUp(ctx context.Context, domain, token, keyAuth string) error {
+	return os.Remove(filepath.Join(s.Root, ".well-known", "acme-challenge", token))
+}
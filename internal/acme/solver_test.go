@@ -0,0 +1,34 @@
+package acme
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWebrootSolver(t *testing.T) {
+	root := t.TempDir()
+	s := &WebrootSolver{Root: root}
+	if s.Type() != "http-01" {
+		t.Fatalf("Type = %s", s.Type())
+	}
+	ctx := context.Background()
+	if err := s.Present(ctx, "example.com", "tok123", "tok123.thumb"); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(root, ".well-known", "acme-challenge", "tok123")
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "tok123.thumb" {
+		t.Errorf("challenge file = %q", b)
+	}
+	if err := s.CleanUp(ctx, "example.com", "tok123", "tok123.thumb"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("challenge file left behind: %v", err)
+	}
+}
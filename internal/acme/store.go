@@ -0,0 +1,63 @@
+package acme
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+)
+
+var numberedRe = regexp.MustCompile(`^fullchain(\d+)\.pem$`)
+
+// Save writes cert into dir using certbot's numbered layout
+// (privkeyN.pem, certN.pem, chainN.pem, fullchainN.pem) with the next free N,
+// and refreshes the unnumbered privkey.pem/fullchain.pem used by web servers.
+// It returns the paths of the new private key and fullchain.
+func Save(dir string, cert *Certificate) (privPath, fullchainPath string, err error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", "", err
+	}
+	ents, err := os.ReadDir(dir)
+	if err != nil {
+		return "", "", err
+	}
+	next := 1
+	for _, e := range ents {
+		if m := numberedRe.FindStringSubmatch(e.Name()); m != nil {
+			if n, _ := strconv.Atoi(m[1]); n >= next {
+				next = n + 1
+			}
+		}
+	}
+	files := []struct {
+		base string
+		data []byte
+		mode os.FileMode
+	}{
+		{"privkey", cert.PrivateKey, 0o600},
+		{"cert", cert.Cert, 0o644},
+		{"chain", cert.Chain, 0o644},
+		{"fullchain", cert.Fullchain, 0o644},
+	}
+	for _, f := range files {
+		p := filepath.Join(dir, fmt.Sprintf("%s%d.pem", f.base, next))
+		if err := os.WriteFile(p, f.data, f.mode); err != nil {
+			return "", "", err
+		}
+		if err := replaceFile(filepath.Join(dir, f.base+".pem"), f.data, f.mode); err != nil {
+			return "", "", err
+		}
+	}
+	return filepath.Join(dir, fmt.Sprintf("privkey%d.pem", next)), filepath.Join(dir, fmt.Sprintf("fullchain%d.pem", next)), nil
+}
+
+// replaceFile swaps path for a new file via rename so an existing symlink is
+// replaced instead of written through.
+func replaceFile(path string, data []byte, mode os.FileMode) error {
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, mode); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
@@ -0,0 +1,112 @@
+package acme
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func testCert(tag string) *Certificate {
+	return &Certificate{
+		PrivateKey: []byte("key " + tag),
+		Cert:       []byte("cert " + tag),
+		Chain:      []byte("chain " + tag),
+		Fullchain:  []byte("fullchain " + tag),
+	}
+}
+
+func readFile(t *testing.T, path string) string {
+	t.Helper()
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
+
+func TestSaveNumbering(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "live", "example.com")
+
+	priv, full, err := Save(dir, testCert("1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if priv != filepath.Join(dir, "privkey1.pem") || full != filepath.Join(dir, "fullchain1.pem") {
+		t.Fatalf("first save = %s, %s", priv, full)
+	}
+
+	// a gap left by manual cleanup does not get reused
+	if err := os.WriteFile(filepath.Join(dir, "fullchain5.pem"), nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	priv, full, err = Save(dir, testCert("2"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if priv != filepath.Join(dir, "privkey6.pem") || full != filepath.Join(dir, "fullchain6.pem") {
+		t.Fatalf("second save = %s, %s", priv, full)
+	}
+
+	for base, want := range map[string]string{
+		"privkey1.pem":   "key 1",
+		"fullchain1.pem": "fullchain 1",
+		"privkey6.pem":   "key 2",
+		"cert6.pem":      "cert 2",
+		"chain6.pem":     "chain 2",
+		"fullchain6.pem": "fullchain 2",
+		"privkey.pem":    "key 2",
+		"fullchain.pem":  "fullchain 2",
+	} {
+		if got := readFile(t, filepath.Join(dir, base)); got != want {
+			t.Errorf("%s = %q, want %q", base, got, want)
+		}
+	}
+	fi, err := os.Stat(filepath.Join(dir, "privkey6.pem"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi.Mode().Perm() != 0o600 {
+		t.Errorf("privkey6.pem mode = %v, want 0600", fi.Mode().Perm())
+	}
+}
+
+func TestSaveReplacesSymlinks(t *testing.T) {
+	root := t.TempDir()
+	archive := filepath.Join(root, "archive", "example.com")
+	live := filepath.Join(root, "live", "example.com")
+	for _, d := range []string{archive, live} {
+		if err := os.MkdirAll(d, 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// certbot's layout: live/ links into archive/
+	for _, base := range []string{"privkey", "cert", "chain", "fullchain"} {
+		target := filepath.Join(archive, base+"1.pem")
+		if err := os.WriteFile(target, []byte("certbot "+base), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Symlink(target, filepath.Join(live, base+".pem")); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if _, _, err := Save(live, testCert("new")); err != nil {
+		t.Fatal(err)
+	}
+	for _, base := range []string{"privkey", "cert", "chain", "fullchain"} {
+		p := filepath.Join(live, base+".pem")
+		fi, err := os.Lstat(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if fi.Mode()&os.ModeSymlink != 0 {
+			t.Errorf("%s is still a symlink", p)
+		}
+		if got := readFile(t, filepath.Join(archive, base+"1.pem")); got != "certbot "+base {
+			t.Errorf("archive %s1.pem was written through: %q", base, got)
+		}
+	}
+	if got := readFile(t, filepath.Join(live, "fullchain.pem")); got != "fullchain new" {
+		t.Errorf("fullchain.pem = %q", got)
+	}
+}
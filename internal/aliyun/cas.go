@@ -0,0 +1,138 @@
+package aliyun
+
+import (
+	"context"
+	"math/big"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const CASEndpoint = "cas.aliyuncs.com"
+
+// CAS manages uploaded certificates in Alibaba Cloud Certificate Management
+// Service, from which SLB, WAF, OSS and other products pick certificates.
+type CAS struct {
+	*Client
+	region string
+}
+
+// NewCAS returns a CAS client; endpoint defaults to CASEndpoint.
+func NewCAS(accessKeyId, accessKeySecret, endpoint string) (*CAS, error) {
+	if endpoint == "" {
+		endpoint = CASEndpoint
+	}
+	c, err := New(accessKeyId, accessKeySecret, endpoint, "2020-04-07")
+	if err != nil {
+		return nil, err
+	}
+	return &CAS{Client: c, region: casRegion(endpoint)}, nil
+}
+
+// Region is the region certificates are stored in: the one named by a
+// regional endpoint such as cas.ap-southeast-1.aliyuncs.com, otherwise
+// DefaultRegion, where the central endpoint keeps them.
+func (c *CAS) Region() string { return c.region }
+
+func casRegion(endpoint string) string {
+	host := strings.TrimPrefix(strings.TrimPrefix(endpoint, "https://"), "http://")
+	parts := strings.Split(strings.ToLower(host), ".")
+	if len(parts) == 4 && parts[0] == "cas" && parts[2] == "aliyuncs" && parts[3] == "com" {
+		return parts[1]
+	}
+	return DefaultRegion
+}
+
+// CASCert is an uploaded certificate as listed by ListUserCertificateOrder.
+type CASCert struct {
+	ID         string
+	Name       string
+	CommonName string
+	// SerialNo is the certificate serial number in hex.
+	SerialNo string
+	EndDate  string
+}
+
+// SameSerial reports whether the listed serial number is serial, ignoring
+// case and leading zeros.
+func (c CASCert) SameSerial(serial *big.Int) bool {
+	n, ok := new(big.Int).SetString(strings.TrimPrefix(strings.ToLower(c.SerialNo), "0x"), 16)
+	return ok && n.Cmp(serial) == 0
+}
+
+// Upload stores a certificate and returns its CertId. Every call creates a
+// new entry, so it is not retried.
+func (c *CAS) Upload(ctx context.Context, name, certPEM, keyPEM string) (string, error) {
+	var out struct {
+		CertId ID
+	}
+	err := c.CallOnce(ctx, "UploadUserCertificate", map[string]string{
+		"Name": name,
+		"Cert": certPEM,
+		"Key":  keyPEM,
+	}, &out)
+	return string(out.CertId), err
+}
+
+// List returns the uploaded certificates matching keyword, newest first.
+func (c *CAS) List(ctx context.Context, keyword string) ([]CASCert, error) {
+	const pageSize = 50
+	var certs []CASCert
+	for page := 1; ; page++ {
+		q := map[string]string{
+			"OrderType":   "UPLOAD",
+			"CurrentPage": strconv.Itoa(page),
+			"ShowSize":    strconv.Itoa(pageSize),
+		}
+		if keyword != "" {
+			q["Keyword"] = keyword
+		}
+		var out struct {
+			TotalCount           int
+			CertificateOrderList []struct {
+				CertificateId ID
+				Name          string
+				CommonName    string
+				SerialNo      string
+				EndDate       string
+			}
+		}
+		if err := c.Call(ctx, "ListUserCertificateOrder", q, &out); err != nil {
+			return nil, err
+		}
+		for _, o := range out.CertificateOrderList {
+			certs = append(certs, CASCert{
+				ID:         string(o.CertificateId),
+				Name:       o.Name,
+				CommonName: o.CommonName,
+				SerialNo:   o.SerialNo,
+				EndDate:    o.EndDate,
+			})
+		}
+		if len(out.CertificateOrderList) < pageSize || len(certs) >= out.TotalCount {
+			break
+		}
+	}
+	// IDs grow with every upload
+	sort.SliceStable(certs, func(i, k int) bool {
+		a, _ := strconv.ParseInt(certs[i].ID, 10, 64)
+		b, _ := strconv.ParseInt(certs[k].ID, 10, 64)
+		return a > b
+	})
+	return certs, nil
+}
+
+// Get returns the certificate PEM stored under id.
+func (c *CAS) Get(ctx context.Context, id string) (string, error) {
+	var out struct {
+		Cert string
+	}
+	err := c.Call(ctx, "GetUserCertificateDetail", map[string]string{"CertId": id}, &out)
+	return out.Cert, err
+}
+
+// Delete removes an uploaded certificate. The service refuses certificates
+// still deployed to a product.
+func (c *CAS) Delete(ctx context.Context, id string) error {
+	return c.Call(ctx, "DeleteUserCertificate", map[string]string{"CertId": id}, nil)
+}
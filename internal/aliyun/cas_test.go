@@ -0,0 +1,62 @@
+package aliyun
+
+import (
+	"context"
+	"math/big"
+	"net/url"
+	"strconv"
+	"testing"
+)
+
+func TestCASRegion(t *testing.T) {
+	for endpoint, want := range map[string]string{
+		"":                                      DefaultRegion,
+		"cas.aliyuncs.com":                      DefaultRegion,
+		"cas.ap-southeast-1.aliyuncs.com":       "ap-southeast-1",
+		"https://cas.eu-central-1.aliyuncs.com": "eu-central-1",
+		"http://127.0.0.1:18080":                DefaultRegion,
+	} {
+		c, err := NewCAS("ak", "secret", endpoint)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if c.Region() != want {
+			t.Errorf("NewCAS(%q).Region() = %s, want %s", endpoint, c.Region(), want)
+		}
+	}
+	if got := CASCertID("12345", "ap-southeast-1"); got != "12345-ap-southeast-1" {
+		t.Errorf("CASCertID = %s", got)
+	}
+}
+
+func TestCASListPages(t *testing.T) {
+	const total = 55
+	endpoint, calls := fakeRPC(t, map[string]func(url.Values) any{
+		"ListUserCertificateOrder": func(q url.Values) any {
+			page, _ := strconv.Atoi(q.Get("CurrentPage"))
+			size, _ := strconv.Atoi(q.Get("ShowSize"))
+			var list []map[string]any
+			for i := (page-1)*size + 1; i <= min(page*size, total); i++ {
+				list = append(list, map[string]any{"CertificateId": i, "CommonName": "example.com", "SerialNo": "0A"})
+			}
+			return map[string]any{"TotalCount": total, "CertificateOrderList": list}
+		},
+	})
+	c, err := NewCAS("ak", "secret", endpoint)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certs, err := c.List(context.Background(), "example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(certs) != total || certs[0].ID != "55" || certs[total-1].ID != "1" {
+		t.Fatalf("got %d certificates, first %s", len(certs), certs[0].ID)
+	}
+	if !certs[0].SameSerial(big.NewInt(10)) {
+		t.Errorf("serial %s does not match 10", certs[0].SerialNo)
+	}
+	if len(*calls) != 2 || (*calls)[0].Params.Get("Keyword") != "example.com" {
+		t.Errorf("calls = %+v", *calls)
+	}
+}
@@ -0,0 +1,164 @@
+package aliyun
+
+import (
+	"context"
+	"fmt"
+)
+
+// CDN sets and reads the HTTPS certificate of Alibaba Cloud CDN domains, or of
+// DCDN (full site acceleration) domains, whose API mirrors CDN's.
+type CDN struct {
+	*Client
+	dcdn bool
+}
+
+const (
+	CDNEndpoint  = "cdn.aliyuncs.com"
+	DCDNEndpoint = "dcdn.aliyuncs.com"
+)
+
+// NewCDN returns a CDN client; endpoint defaults to the public endpoint of
+// the product.
+func NewCDN(accessKeyId, accessKeySecret, endpoint string, dcdn bool) (*CDN, error) {
+	version := "2018-05-10"
+	if dcdn {
+		version = "2018-01-15"
+	}
+	if endpoint == "" {
+		endpoint = CDNEndpoint
+		if dcdn {
+			endpoint = DCDNEndpoint
+		}
+	}
+	c, err := New(accessKeyId, accessKeySecret, endpoint, version)
+	if err != nil {
+		return nil, err
+	}
+	return &CDN{Client: c, dcdn: dcdn}, nil
+}
+
+func (c *CDN) String() string {
+	if c.dcdn {
+		return "DCDN"
+	}
+	return "CDN"
+}
+
+// DomainCert is a domain's HTTPS state as reported by
+// Describe(Dcdn)DomainCertificateInfo.
+type DomainCert struct {
+	Domain string
+	// Enabled reports whether HTTPS is on.
+	Enabled  bool
+	CertName string
+	CertID   string
+	// CertType is "upload", "cas" or "free".
+	CertType string
+	// Status is "success" once the configuration has taken effect.
+	Status string
+	// PEM is the served certificate, leaf first.
+	PEM string
+}
+
+type certInfo struct {
+	DomainName string
+	CertName   string
+	CertId     ID
+	CertType   string
+	Status     string
+	// CDN names
+	ServerCertificateStatus string
+	ServerCertificate       string
+	// DCDN names
+	SSLProtocol string
+	SSLPub      string
+}
+
+// DomainCert describes the certificate currently configured for domain.
+func (c *CDN) DomainCert(ctx context.Context, domain string) (*DomainCert, error) {
+	action := "DescribeDomainCertificateInfo"
+	if c.dcdn {
+		action = "DescribeDcdnDomainCertificateInfo"
+	}
+	var out struct {
+		CertInfos struct {
+			CertInfo []certInfo
+		}
+	}
+	if err := c.Call(ctx, action, map[string]string{"DomainName": domain}, &out); err != nil {
+		return nil, err
+	}
+	for _, ci := range out.CertInfos.CertInfo {
+		if ci.DomainName != "" && ci.DomainName != domain {
+			continue
+		}
+		dc := &DomainCert{
+			Domain:   domain,
+			Enabled:  ci.ServerCertificateStatus == "on" || ci.SSLProtocol == "on",
+			CertName: ci.CertName,
+			CertID:   string(ci.CertId),
+			CertType: ci.CertType,
+			Status:   ci.Status,
+			PEM:      ci.ServerCertificate,
+		}
+		if dc.PEM == "" {
+			dc.PEM = ci.SSLPub
+		}
+		return dc, nil
+	}
+	return nil, fmt.Errorf("%s: no certificate info for %s", action, domain)
+}
+
+// SSLCert is the certificate to configure: either an uploaded PEM pair or a
+// certificate already in Certificate Management Service.
+type SSLCert struct {
+	Name string
+	// Pub is the fullchain and Pri the private key of an uploaded certificate.
+	Pub, Pri string
+	// CASID selects a Certificate Management Service certificate instead.
+	CASID string
+	// Type is sent as CertType with CASID and defaults to "cas"; "upload"
+	// rebinds an earlier upload by its ID. Type "free" requests the
+	// service's free certificate and needs no ID.
+	Type string
+}
+
+// SetCert enables HTTPS on domain with cert. Uploads create a certificate
+// each time, so the call is not retried.
+func (c *CDN) SetCert(ctx context.Context, domain string, cert SSLCert) error {
+	q := map[string]string{
+		"DomainName":  domain,
+		"SSLProtocol": "on",
+	}
+	if cert.Name != "" {
+		q["CertName"] = cert.Name
+	}
+	switch {
+	case cert.Type == "free":
+		q["CertType"] = cert.Type
+		return c.Call(ctx, c.setAction(), q, nil)
+	case cert.CASID != "":
+		q["CertType"] = "cas"
+		if cert.Type != "" {
+			q["CertType"] = cert.Type
+		}
+		q["CertId"] = cert.CASID
+		return c.Call(ctx, c.setAction(), q, nil)
+	}
+	q["CertType"] = "upload"
+	q["SSLPub"] = cert.Pub
+	q["SSLPri"] = cert.Pri
+	return c.CallOnce(ctx, c.setAction(), q, nil)
+}
+
+// DisableSSL turns HTTPS off for domain.
+func (c *CDN) DisableSSL(ctx context.Context, domain string) error {
+	return c.Call(ctx, c.setAction(), map[string]string{"DomainName": domain, "SSLProtocol": "off"}, nil)
+}
+
+func (c *CDN) setAction() string {
+	if c.dcdn {
+		return "SetDcdnDomainSSLCertificate"
+	}
+	return "SetCdnDomainSSLCertificate"
+}
@@ -0,0 +1,160 @@
+package aliyun
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"auto-https/internal/retry"
+)
+
+// rpcCall is one request received by the fake OpenAPI endpoint.
+type rpcCall struct {
+	Action  string
+	Version string
+	Params  url.Values
+}
+
+// fakeRPC serves RPC style actions from handlers keyed by action name and
+// records every call.
+func fakeRPC(t *testing.T, handlers map[string]func(q url.Values) any) (string, *[]rpcCall) {
+	var calls []rpcCall
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			t.Errorf("parse form: %v", err)
+		}
+		action := r.Header.Get("x-acs-action")
+		calls = append(calls, rpcCall{Action: action, Version: r.Header.Get("x-acs-version"), Params: r.Form})
+		h, ok := handlers[action]
+		if !ok {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"Code": "InvalidAction.NotFound", "Message": action})
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(h(r.Form))
+	}))
+	t.Cleanup(srv.Close)
+	return srv.URL, &calls
+}
+
+func newTestCDN(t *testing.T, endpoint string, dcdn bool) *CDN {
+	c, err := NewCDN("ak", "secret", endpoint, dcdn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Retry = retry.Policy{Attempts: 1}
+	return c
+}
+
+func TestDomainCertCDN(t *testing.T) {
+	endpoint, calls := fakeRPC(t, map[string]func(url.Values) any{
+		"DescribeDomainCertificateInfo": func(q url.Values) any {
+			return map[string]any{"CertInfos": map[string]any{"CertInfo": []map[string]any{{
+				"DomainName":              q.Get("DomainName"),
+				"CertName":                "old",
+				"CertId":                  12345,
+				"CertType":                "cas",
+				"Status":                  "success",
+				"ServerCertificateStatus": "on",
+				"ServerCertificate":       "PEM",
+			}}}}
+		},
+	})
+	dc, err := newTestCDN(t, endpoint, false).DomainCert(context.Background(), "img.example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := DomainCert{Domain: "img.example.com", Enabled: true, CertName: "old", CertID: "12345", CertType: "cas", Status: "success", PEM: "PEM"}
+	if *dc != want {
+		t.Errorf("DomainCert = %+v, want %+v", *dc, want)
+	}
+	if c := (*calls)[0]; c.Version != "2018-05-10" || c.Params.Get("DomainName") != "img.example.com" {
+		t.Errorf("call = %+v", c)
+	}
+}
+
+func TestDomainCertDCDN(t *testing.T) {
+	endpoint, calls := fakeRPC(t, map[string]func(url.Values) any{
+		"DescribeDcdnDomainCertificateInfo": func(q url.Values) any {
+			return map[string]any{"CertInfos": map[string]any{"CertInfo": []map[string]any{
+				{"DomainName": "other.example.com", "SSLProtocol": "on", "SSLPub": "OTHER"},
+				{"DomainName": q.Get("DomainName"), "CertName": "site", "CertId": "678", "SSLProtocol": "off", "SSLPub": "PEM"},
+			}}}
+		},
+	})
+	dc, err := newTestCDN(t, endpoint, true).DomainCert(context.Background(), "www.example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := DomainCert{Domain: "www.example.com", CertName: "site", CertID: "678", PEM: "PEM"}
+	if *dc != want {
+		t.Errorf("DomainCert = %+v, want %+v", *dc, want)
+	}
+	if v := (*calls)[0].Version; v != "2018-01-15" {
+		t.Errorf("version = %s", v)
+	}
+}
+
+func TestDomainCertMissing(t *testing.T) {
+	endpoint, _ := fakeRPC(t, map[string]func(url.Values) any{
+		"DescribeDomainCertificateInfo": func(q url.Values) any {
+			return map[string]any{"CertInfos": map[string]any{"CertInfo": []any{}}}
+		},
+	})
+	if _, err := newTestCDN(t, endpoint, false).DomainCert(context.Background(), "img.example.com"); err == nil {
+		t.Error("missing certificate info accepted")
+	}
+}
+
+func TestSetCertAndDisable(t *testing.T) {
+	for _, dcdn := range []bool{false, true} {
+		action := "SetCdnDomainSSLCertificate"
+		if dcdn {
+			action = "SetDcdnDomainSSLCertificate"
+		}
+		endpoint, calls := fakeRPC(t, map[string]func(url.Values) any{
+			action: func(url.Values) any { return map[string]string{"RequestId": "r"} },
+		})
+		c := newTestCDN(t, endpoint, dcdn)
+		ctx := context.Background()
+		if err := c.SetCert(ctx, "img.example.com", SSLCert{Name: "new", Pub: "CHAIN", Pri: "KEY"}); err != nil {
+			t.Fatal(err)
+		}
+		if err := c.SetCert(ctx, "www.example.com", SSLCert{CASID: "999"}); err != nil {
+			t.Fatal(err)
+		}
+		if err := c.SetCert(ctx, "up.example.com", SSLCert{CASID: "998", Type: "upload"}); err != nil {
+			t.Fatal(err)
+		}
+		if err := c.SetCert(ctx, "free.example.com", SSLCert{Type: "free"}); err != nil {
+			t.Fatal(err)
+		}
+		if err := c.DisableSSL(ctx, "old.example.com"); err != nil {
+			t.Fatal(err)
+		}
+		want := []map[string]string{
+			{"DomainName": "img.example.com", "SSLProtocol": "on", "CertType": "upload", "CertName": "new", "SSLPub": "CHAIN", "SSLPri": "KEY"},
+			{"DomainName": "www.example.com", "SSLProtocol": "on", "CertType": "cas", "CertId": "999"},
+			{"DomainName": "up.example.com", "SSLProtocol": "on", "CertType": "upload", "CertId": "998"},
+			{"DomainName": "free.example.com", "SSLProtocol": "on", "CertType": "free"},
+			{"DomainName": "old.example.com", "SSLProtocol": "off"},
+		}
+		if len(*calls) != len(want) {
+			t.Fatalf("%s: %d calls, want %d", c, len(*calls), len(want))
+		}
+		for i, call := range *calls {
+			if call.Action != action {
+				t.Errorf("%s: call %d action %s", c, i, call.Action)
+			}
+			for _, k := range []string{"DomainName", "SSLProtocol", "CertType", "CertName", "CertId", "SSLPub", "SSLPri"} {
+				if got := call.Params.Get(k); got != want[i][k] {
+					t.Errorf("%s: call %d %s = %q, want %q", c, i, k, got, want[i][k])
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,148 @@
+// Package aliyun calls Alibaba Cloud OpenAPI products for which no SDK is
+// vendored, through the generic RPC entry point of the OpenAPI client. It
+// holds the credential, timeout and retry handling shared with internal/dns.
+package aliyun
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+
+	openapi "github.com/alibabacloud-go/darabonba-openapi/v2/client"
+	util "github.com/alibabacloud-go/tea-utils/v2/service"
+	"github.com/alibabacloud-go/tea/dara"
+	"github.com/alibabacloud-go/tea/tea"
+
+	"auto-https/internal/retry"
+)
+
+// Config returns the OpenAPI client configuration for an AccessKey pair.
+// endpoint is a host name; an http:// prefix selects plain HTTP, which is only
+// meant for local fakes of the API.
+func Config(accessKeyId, accessKeySecret, endpoint string) *openapi.Config {
+	cfg := &openapi.Config{
+		AccessKeyId:     tea.String(accessKeyId),
+		AccessKeySecret: tea.String(accessKeySecret),
+	}
+	if rest, ok := strings.CutPrefix(endpoint, "http://"); ok {
+		endpoint = rest
+		cfg.Protocol = tea.String("http")
+	}
+	cfg.Endpoint = tea.String(strings.TrimPrefix(endpoint, "https://"))
+	return cfg
+}
+
+// Client calls the RPC style actions of one product version.
+type Client struct {
+	api     *openapi.Client
+	version string
+	// Retry applies to Call; CallOnce is never retried.
+	Retry retry.Policy
+}
+
+func New(accessKeyId, accessKeySecret, endpoint, version string) (*Client, error) {
+	api, err := openapi.NewClient(Config(accessKeyId, accessKeySecret, endpoint))
+	if err != nil {
+		return nil, err
+	}
+	return &Client{api: api, version: version, Retry: retry.Default}, nil
+}
+
+// Call runs an idempotent action under the retry policy and decodes the
+// response body into out, which may be nil.
+func (c *Client) Call(ctx context.Context, action string, query map[string]string, out any) error {
+	return retry.Do(ctx, c.Retry, action, Retryable, func(ctx context.Context) error {
+		return c.call(ctx, action, query, out)
+	})
+}
+
+// CallOnce runs an action that must not be repeated blindly, such as an
+// upload that creates a new resource each time.
+func (c *Client) CallOnce(ctx context.Context, action string, query map[string]string, out any) error {
+	if c.Retry.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.Retry.Timeout)
+		defer cancel()
+	}
+	return c.call(ctx, action, query, out)
+}
+
+func (c *Client) call(ctx context.Context, action string, query map[string]string, out any) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	req := &openapi.OpenApiRequest{Query: map[string]*string{}}
+	for k, v := range query {
+		req.Query[k] = tea.String(v)
+	}
+	params := &openapi.Params{
+		Action:      tea.String(action),
+		Version:     tea.String(c.version),
+		Protocol:    tea.String("HTTPS"),
+		Pathname:    tea.String("/"),
+		Method:      tea.String("POST"),
+		AuthType:    tea.String("AK"),
+		Style:       tea.String("RPC"),
+		ReqBodyType: tea.String("formData"),
+		BodyType:    tea.String("json"),
+	}
+	res, err := c.api.CallApi(params, req, RuntimeOptions(ctx, 0))
+	if err != nil {
+		return err
+	}
+	if out == nil {
+		return nil
+	}
+	b, err := json.Marshal(res["body"])
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, out)
+}
+
+// RuntimeOptions turns the context deadline, or timeout when sooner, into the
+// SDK's read and connect timeouts; the SDK itself is not context aware.
+func RuntimeOptions(ctx context.Context, timeout time.Duration) *util.RuntimeOptions {
+	runtime := &util.RuntimeOptions{}
+	if d, ok := ctx.Deadline(); ok && (timeout <= 0 || time.Until(d) < timeout) {
+		timeout = time.Until(d)
+	}
+	if timeout > 0 {
+		ms := int(timeout / time.Millisecond)
+		if ms < 1 {
+			ms = 1
+		}
+		runtime.ReadTimeout = tea.Int(ms)
+		runtime.ConnectTimeout = tea.Int(ms)
+	}
+	return runtime
+}
+
+// Retryable reports server side and throttling errors from an Alibaba Cloud
+// OpenAPI call. Client errors such as bad credentials are final.
+func Retryable(err error) bool {
+	var se *dara.SDKError
+	if !errors.As(err, &se) {
+		return false
+	}
+	if se.StatusCode != nil && *se.StatusCode >= 500 {
+		return true
+	}
+	code := tea.StringValue(se.Code)
+	return strings.Contains(code, "Throttling") || strings.Contains(code, "ServiceUnavailable") ||
+		strings.Contains(code, "InternalError")
+}
+
+// ID is a resource ID that the API returns as a number in some responses and
+// as a string in others.
+type ID string
+
+func (id *ID) UnmarshalJSON(b []byte) error {
+	*id = ID(strings.Trim(string(b), `"`))
+	if *id == "null" {
+		*id = ""
+	}
+	return nil
+}
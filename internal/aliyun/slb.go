@@ -0,0 +1,191 @@
+package aliyun
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+)
+
+// DefaultRegion is used when a load balancer target names no region.
+const DefaultRegion = "cn-hangzhou"
+
+// SLB manages server certificates and HTTPS listeners of Classic Load
+// Balancer instances in one region.
+type SLB struct {
+	*Client
+	region string
+}
+
+// NewSLB returns a client for region; endpoint defaults to the regional
+// endpoint.
+func NewSLB(accessKeyId, accessKeySecret, region, endpoint string) (*SLB, error) {
+	if region == "" {
+		region = DefaultRegion
+	}
+	if endpoint == "" {
+		endpoint = "slb." + region + ".aliyuncs.com"
+	}
+	c, err := New(accessKeyId, accessKeySecret, endpoint, "2014-05-15")
+	if err != nil {
+		return nil, err
+	}
+	return &SLB{Client: c, region: region}, nil
+}
+
+// ServerCert is a certificate uploaded to SLB.
+type ServerCert struct {
+	ID   string
+	Name string
+	// Fingerprint is the SHA-1 of the certificate, colon separated hex.
+	Fingerprint string
+}
+
+func (c *SLB) ServerCertificates(ctx context.Context) ([]ServerCert, error) {
+	var out struct {
+		ServerCertificates struct {
+			ServerCertificate []struct {
+				ServerCertificateId   string
+				ServerCertificateName string
+				Fingerprint           string
+			}
+		}
+	}
+	if err := c.Call(ctx, "DescribeServerCertificates", map[string]string{"RegionId": c.region}, &out); err != nil {
+		return nil, err
+	}
+	var certs []ServerCert
+	for _, s := range out.ServerCertificates.ServerCertificate {
+		certs = append(certs, ServerCert{ID: s.ServerCertificateId, Name: s.ServerCertificateName, Fingerprint: s.Fingerprint})
+	}
+	return certs, nil
+}
+
+// UploadServerCertificate stores a certificate and returns its ID. Every call
+// creates a new certificate, so it is not retried.
+func (c *SLB) UploadServerCertificate(ctx context.Context, name, certPEM, keyPEM string) (string, error) {
+	var out struct {
+		ServerCertificateId string
+	}
+	err := c.CallOnce(ctx, "UploadServerCertificate", map[string]string{
+		"RegionId":              c.region,
+		"ServerCertificateName": name,
+		"ServerCertificate":     certPEM,
+		"PrivateKey":            keyPEM,
+	}, &out)
+	return out.ServerCertificateId, err
+}
+
+func (c *SLB) DeleteServerCertificate(ctx context.Context, id string) error {
+	return c.Call(ctx, "DeleteServerCertificate", map[string]string{"RegionId": c.region, "ServerCertificateId": id}, nil)
+}
+
+// ListenerCert returns the server certificate ID of an HTTPS listener.
+func (c *SLB) ListenerCert(ctx context.Context, lb string, port int) (string, error) {
+	var out struct {
+		ServerCertificateId string
+	}
+	err := c.Call(ctx, "DescribeLoadBalancerHTTPSListenerAttribute", map[string]string{
+		"RegionId":       c.region,
+		"LoadBalancerId": lb,
+		"ListenerPort":   strconv.Itoa(port),
+	}, &out)
+	return out.ServerCertificateId, err
+}
+
+// SetListenerCert switches an HTTPS listener to server certificate id,
+// leaving its other attributes unchanged.
+func (c *SLB) SetListenerCert(ctx context.Context, lb string, port int, id string) error {
+	return c.Call(ctx, "SetLoadBalancerHTTPSListenerAttribute", map[string]string{
+		"RegionId":            c.region,
+		"LoadBalancerId":      lb,
+		"ListenerPort":        strconv.Itoa(port),
+		"ServerCertificateId": id,
+	}, nil)
+}
+
+// ALB manages the default certificate of Application Load Balancer HTTPS
+// listeners. ALB only uses Certificate Management Service certificates.
+type ALB struct {
+	*Client
+	region string
+}
+
+// NewALB returns a client for region; endpoint defaults to the regional
+// endpoint.
+func NewALB(accessKeyId, accessKeySecret, region, endpoint string) (*ALB, error) {
+	if region == "" {
+		region = DefaultRegion
+	}
+	if endpoint == "" {
+		endpoint = "alb." + region + ".aliyuncs.com"
+	}
+	c, err := New(accessKeyId, accessKeySecret, endpoint, "2020-06-16")
+	if err != nil {
+		return nil, err
+	}
+	return &ALB{Client: c, region: region}, nil
+}
+
+// Listener is an ALB listener and its default certificate.
+type Listener struct {
+	ID     string
+	Status string
+	CertID string
+}
+
+// FindListener returns the HTTPS listener of lb on port.
+func (c *ALB) FindListener(ctx context.Context, lb string, port int) (*Listener, error) {
+	var out struct {
+		Listeners []struct {
+			ListenerId       string
+			ListenerPort     int
+			ListenerProtocol string
+		}
+	}
+	err := c.Call(ctx, "ListListeners", map[string]string{
+		"LoadBalancerIds.1": lb,
+		"ListenerProtocol":  "HTTPS",
+		"MaxResults":        "100",
+	}, &out)
+	if err != nil {
+		return nil, err
+	}
+	for _, l := range out.Listeners {
+		if l.ListenerPort == port {
+			return c.Listener(ctx, l.ListenerId)
+		}
+	}
+	return nil, fmt.Errorf("no HTTPS listener on port %d of %s", port, lb)
+}
+
+func (c *ALB) Listener(ctx context.Context, id string) (*Listener, error) {
+	var out struct {
+		ListenerStatus string
+		Certificates   []struct {
+			CertificateId string
+		}
+	}
+	if err := c.Call(ctx, "GetListenerAttribute", map[string]string{"ListenerId": id}, &out); err != nil {
+		return nil, err
+	}
+	l := &Listener{ID: id, Status: out.ListenerStatus}
+	if len(out.Certificates) > 0 {
+		l.CertID = out.Certificates[0].CertificateId
+	}
+	return l, nil
+}
+
+// SetListenerCert replaces the default certificate of a listener. The change
+// is applied asynchronously; the listener is "Running" again once done.
+func (c *ALB) SetListenerCert(ctx context.Context, id, certID string) error {
+	return c.Call(ctx, "UpdateListenerAttribute", map[string]string{
+		"ListenerId":                   id,
+		"Certificates.1.CertificateId": certID,
+	}, nil)
+}
+
+// CASCertID is how ALB refers to a Certificate Management Service
+// certificate: the CertId suffixed with the region it is stored in.
+func CASCertID(id, region string) string {
+	return id + "-" + region
+}
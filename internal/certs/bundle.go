@@ -0,0 +1,110 @@
+package certs
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// Bundle is a private key and certificate chain read from disk, kept both
+// parsed and as the original PEM for uploading.
+type Bundle struct {
+	KeyPath   string
+	ChainPath string
+	KeyPEM    []byte
+	ChainPEM  []byte
+	// Chain is leaf first, as found in ChainPEM.
+	Chain []*x509.Certificate
+}
+
+func (b *Bundle) Leaf() *x509.Certificate { return b.Chain[0] }
+
+// LoadBundle reads keyPath and chainPath (a fullchain PEM) and checks that the
+// key belongs to the leaf certificate.
+func LoadBundle(keyPath, chainPath string) (*Bundle, error) {
+	keyPEM, err := os.ReadFile(keyPath)
+	if err != nil {
+		return nil, err
+	}
+	chainPEM, err := os.ReadFile(chainPath)
+	if err != nil {
+		return nil, err
+	}
+	chain, err := ParseChain(chainPEM)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", chainPath, err)
+	}
+	if _, err := tls.X509KeyPair(chainPEM, keyPEM); err != nil {
+		return nil, fmt.Errorf("%s does not match %s: %w", keyPath, chainPath, err)
+	}
+	return &Bundle{KeyPath: keyPath, ChainPath: chainPath, KeyPEM: keyPEM, ChainPEM: chainPEM, Chain: chain}, nil
+}
+
+// VerifyOptions controls Bundle.Verify.
+type VerifyOptions struct {
+	// Roots replaces the system pool when non-nil.
+	Roots *x509.CertPool
+	// Hosts must all be covered by the leaf. Qiniu pan-domains written with a
+	// leading dot are not checked.
+	Hosts []string
+	// Now defaults to time.Now.
+	Now time.Time
+}
+
+// Verify refuses a bundle that is expired or not yet valid, does not chain to
+// a trusted root for server authentication, or does not cover every host.
+func (b *Bundle) Verify(opts VerifyOptions) error {
+	now := opts.Now
+	if now.IsZero() {
+		now = time.Now()
+	}
+	leaf := b.Leaf()
+	if now.Before(leaf.NotBefore) {
+		return fmt.Errorf("certificate not valid before %s", leaf.NotBefore.Format(time.RFC3339))
+	}
+	if now.After(leaf.NotAfter) {
+		return fmt.Errorf("certificate expired at %s", leaf.NotAfter.Format(time.RFC3339))
+	}
+	inter := x509.NewCertPool()
+	for _, c := range b.Chain[1:] {
+		inter.AddCert(c)
+	}
+	if _, err := leaf.Verify(x509.VerifyOptions{
+		Roots:         opts.Roots,
+		Intermediates: inter,
+		CurrentTime:   now,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}); err != nil {
+		return fmt.Errorf("chain does not verify: %w", err)
+	}
+	var missing []string
+	for _, h := range opts.Hosts {
+		if h == "" || strings.HasPrefix(h, ".") {
+			continue
+		}
+		if !Covers(leaf, h) {
+			missing = append(missing, h)
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("certificate (%s) does not cover %s", strings.Join(leaf.DNSNames, ","), strings.Join(missing, ","))
+	}
+	return nil
+}
+
+// LoadPool reads a PEM bundle of trusted root certificates.
+func LoadPool(path string) (*x509.CertPool, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(b) {
+		return nil, errors.New("no certificates in " + path)
+	}
+	return pool, nil
+}
@@ -0,0 +1,169 @@
+package certs
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testCA issues certificates for tests; a CA created with a parent is an
+// intermediate whose certificate goes into the issued chains.
+type testCA struct {
+	key    *ecdsa.PrivateKey
+	cert   *x509.Certificate
+	parent *testCA
+}
+
+var testSerial int64
+
+func newTestCA(t *testing.T, name string, parent *testCA) *testCA {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testSerial++
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(testSerial),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-365 * 24 * time.Hour),
+		NotAfter:              time.Now().Add(365 * 24 * time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	signer, signerKey := tmpl, key
+	if parent != nil {
+		signer, signerKey = parent.cert, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, signer, &key.PublicKey, signerKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testCA{key: key, cert: cert, parent: parent}
+}
+
+// issue returns a key and a fullchain (leaf, then any intermediates) valid
+// from notBefore to notAfter for names.
+func (ca *testCA) issue(t *testing.T, notBefore, notAfter time.Time, names ...string) (keyPEM, chainPEM []byte) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testSerial++
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(testSerial),
+		Subject:      pkix.Name{CommonName: names[0]},
+		DNSNames:     names,
+		NotBefore:    notBefore,
+		NotAfter:     notAfter,
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyPEM = pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+	chainPEM = pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	for c := ca; c.parent != nil; c = c.parent {
+		chainPEM = append(chainPEM, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: c.cert.Raw})...)
+	}
+	return keyPEM, chainPEM
+}
+
+// writeFile writes data to dir/name, creating dir, and returns the path.
+func writeFile(t *testing.T, dir, name string, data []byte) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadBundleKeyMismatch(t *testing.T) {
+	ca := newTestCA(t, "root", nil)
+	dir := t.TempDir()
+	now := time.Now()
+	key, _ := ca.issue(t, now, now.Add(time.Hour), "www.example.com")
+	_, chain := ca.issue(t, now, now.Add(time.Hour), "www.example.com")
+	_, err := LoadBundle(writeFile(t, dir, "privkey.pem", key), writeFile(t, dir, "fullchain.pem", chain))
+	if err == nil || !strings.Contains(err.Error(), "does not match") {
+		t.Fatalf("LoadBundle with another key: %v", err)
+	}
+}
+
+func TestBundleVerify(t *testing.T) {
+	root := newTestCA(t, "root", nil)
+	inter := newTestCA(t, "intermediate", root)
+	dir := t.TempDir()
+	notBefore := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	notAfter := notBefore.Add(90 * 24 * time.Hour)
+	key, chain := inter.issue(t, notBefore, notAfter, "example.com", "*.example.com")
+	b, err := LoadBundle(writeFile(t, dir, "privkey.pem", key), writeFile(t, dir, "fullchain.pem", chain))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(b.Chain) != 2 || b.Leaf().Subject.CommonName != "example.com" {
+		t.Fatalf("chain = %d certificates, leaf %s", len(b.Chain), b.Leaf().Subject)
+	}
+
+	// the trusted CA is read the way trusted_ca is
+	roots, err := LoadPool(writeFile(t, dir, "root.pem", pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: root.cert.Raw})))
+	if err != nil {
+		t.Fatal(err)
+	}
+	other := x509.NewCertPool()
+	other.AddCert(newTestCA(t, "other root", nil).cert)
+	valid := notBefore.Add(30 * 24 * time.Hour)
+
+	tests := []struct {
+		name string
+		opts VerifyOptions
+		// err is a substring of the expected error, empty for success
+		err string
+	}{
+		{"valid", VerifyOptions{Roots: roots, Now: valid, Hosts: []string{"example.com", "www.example.com", ".example.com", ""}}, ""},
+		{"expired", VerifyOptions{Roots: roots, Now: notAfter.Add(time.Second)}, "expired"},
+		{"not yet valid", VerifyOptions{Roots: roots, Now: notBefore.Add(-time.Second)}, "not valid before"},
+		{"untrusted root", VerifyOptions{Roots: other, Now: valid}, "chain does not verify"},
+		{"host not covered", VerifyOptions{Roots: roots, Now: valid, Hosts: []string{"www.example.com", "a.b.example.com", "example.org"}}, "does not cover a.b.example.com,example.org"},
+	}
+	for _, tt := range tests {
+		err := b.Verify(tt.opts)
+		switch {
+		case tt.err == "" && err != nil:
+			t.Errorf("%s: %v", tt.name, err)
+		case tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)):
+			t.Errorf("%s: error %v, want %q", tt.name, err, tt.err)
+		}
+	}
+
+	// without the intermediate the leaf does not build to the root
+	b.Chain = b.Chain[:1]
+	if err := b.Verify(VerifyOptions{Roots: roots, Now: valid}); err == nil {
+		t.Error("chain without its intermediate verified")
+	}
+}
@@ -0,0 +1,107 @@
+package certs
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ParseChain decodes every CERTIFICATE block in PEM data, leaf first.
+func ParseChain(data []byte) ([]*x509.Certificate, error) {
+	var chain []*x509.Certificate
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		c, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		chain = append(chain, c)
+	}
+	if len(chain) == 0 {
+		return nil, errors.New("no certificate found")
+	}
+	return chain, nil
+}
+
+// LoadLeaf reads a PEM file (cert or fullchain) and returns its first certificate.
+func LoadLeaf(path string) (*x509.Certificate, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	chain, err := ParseChain(b)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return chain[0], nil
+}
+
+// RenewWindow says how long before NotAfter a certificate is due. Either a
+// fixed duration or a fraction of the certificate lifetime is used.
+type RenewWindow struct {
+	Before   time.Duration
+	Fraction float64
+}
+
+// ParseRenewWindow accepts "30d", "72h" or a percentage of lifetime like "33%".
+func ParseRenewWindow(s string) (RenewWindow, error) {
+	s = strings.TrimSpace(s)
+	switch {
+	case strings.HasSuffix(s, "%"):
+		f, err := strconv.ParseFloat(strings.TrimSuffix(s, "%"), 64)
+		if err != nil || f <= 0 || f >= 100 {
+			return RenewWindow{}, fmt.Errorf("invalid renew window %q", s)
+		}
+		return RenewWindow{Fraction: f / 100}, nil
+	case strings.HasSuffix(s, "d"):
+		n, err := strconv.ParseFloat(strings.TrimSuffix(s, "d"), 64)
+		if err != nil || n <= 0 {
+			return RenewWindow{}, fmt.Errorf("invalid renew window %q", s)
+		}
+		return RenewWindow{Before: time.Duration(n * float64(24*time.Hour))}, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d <= 0 {
+		return RenewWindow{}, fmt.Errorf("invalid renew window %q", s)
+	}
+	return RenewWindow{Before: d}, nil
+}
+
+// RenewAt is the moment from which cert should be renewed.
+func (w RenewWindow) RenewAt(cert *x509.Certificate) time.Time {
+	if w.Fraction > 0 {
+		lifetime := cert.NotAfter.Sub(cert.NotBefore)
+		return cert.NotAfter.Add(-time.Duration(float64(lifetime) * w.Fraction))
+	}
+	return cert.NotAfter.Add(-w.Before)
+}
+
+func (w RenewWindow) Due(cert *x509.Certificate, now time.Time) bool {
+	return !now.Before(w.RenewAt(cert))
+}
+
+// Fingerprint is the hex SHA-256 of the certificate DER.
+func Fingerprint(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.Raw)
+	return hex.EncodeToString(sum[:])
+}
+
+// Covers reports whether cert is valid for host, following the usual
+// wildcard rule that *.example.com matches exactly one extra label.
+func Covers(cert *x509.Certificate, host string) bool {
+	return cert.VerifyHostname(host) == nil
+}
@@ -0,0 +1,73 @@
+package certs
+
+import (
+	"crypto/x509"
+	"testing"
+	"time"
+)
+
+func TestParseRenewWindow(t *testing.T) {
+	tests := []struct {
+		in   string
+		want RenewWindow
+	}{
+		{"30d", RenewWindow{Before: 30 * 24 * time.Hour}},
+		{" 72h ", RenewWindow{Before: 72 * time.Hour}},
+		{"1.5d", RenewWindow{Before: 36 * time.Hour}},
+		{"33%", RenewWindow{Fraction: 0.33}},
+	}
+	for _, tt := range tests {
+		got, err := ParseRenewWindow(tt.in)
+		if err != nil {
+			t.Errorf("ParseRenewWindow(%q): %v", tt.in, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ParseRenewWindow(%q) = %+v, want %+v", tt.in, got, tt.want)
+		}
+	}
+
+	for _, in := range []string{"", "0%", "100%", "101%", "-5%", "-1d", "0d", "0h", "-72h", "abc", "30", "d", "%"} {
+		if w, err := ParseRenewWindow(in); err == nil {
+			t.Errorf("ParseRenewWindow(%q) = %+v, want an error", in, w)
+		}
+	}
+}
+
+func TestRenewWindowDue(t *testing.T) {
+	issued := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	ninety := &x509.Certificate{NotBefore: issued, NotAfter: issued.Add(90 * 24 * time.Hour)}
+	six := &x509.Certificate{NotBefore: issued, NotAfter: issued.Add(6 * 24 * time.Hour)}
+	day := 24 * time.Hour
+
+	tests := []struct {
+		window string
+		cert   *x509.Certificate
+		// renewAt is the expected RenewAt as an offset from issued
+		renewAt time.Duration
+	}{
+		{"30d", ninety, 60 * day},
+		{"72h", ninety, 87 * day},
+		{"33%", ninety, 90*day - time.Duration(0.33*float64(90*day))},
+		// a fixed window longer than a short lifetime is due from issuance on
+		{"30d", six, -24 * day},
+		{"72h", six, 3 * day},
+		{"50%", six, 3 * day},
+	}
+	for _, tt := range tests {
+		w, err := ParseRenewWindow(tt.window)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := issued.Add(tt.renewAt)
+		if got := w.RenewAt(tt.cert); !got.Equal(want) {
+			t.Errorf("%s, %v lifetime: RenewAt = %v, want %v", tt.window, tt.cert.NotAfter.Sub(issued), got, want)
+		}
+		if w.Due(tt.cert, want.Add(-time.Second)) {
+			t.Errorf("%s, %v lifetime: due a second before %v", tt.window, tt.cert.NotAfter.Sub(issued), want)
+		}
+		if !w.Due(tt.cert, want) {
+			t.Errorf("%s, %v lifetime: not due at %v", tt.window, tt.cert.NotAfter.Sub(issued), want)
+		}
+	}
+}
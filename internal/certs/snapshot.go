@@ -0,0 +1,54 @@
+package certs
+
+import (
+	"errors"
+	"fmt"
+	"os"
+)
+
+// Snapshot keeps the content of certificate files so a failed deployment can
+// put them back. Paths are read and written through symlinks, so restoring a
+// certbot live link rewrites the archive file it points at.
+type Snapshot struct {
+	paths []string
+	data  map[string][]byte
+	modes map[string]os.FileMode
+}
+
+// TakeSnapshot reads every existing path; missing ones are skipped.
+func TakeSnapshot(paths ...string) (*Snapshot, error) {
+	s := &Snapshot{data: map[string][]byte{}, modes: map[string]os.FileMode{}}
+	for _, p := range paths {
+		if _, ok := s.data[p]; ok {
+			continue
+		}
+		fi, err := os.Stat(p)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		b, err := os.ReadFile(p)
+		if err != nil {
+			return nil, err
+		}
+		s.paths = append(s.paths, p)
+		s.data[p] = b
+		s.modes[p] = fi.Mode().Perm()
+	}
+	return s, nil
+}
+
+func (s *Snapshot) Paths() []string { return s.paths }
+
+// Restore writes the saved content back to every path.
+func (s *Snapshot) Restore() error {
+	var errs []error
+	for _, p := range s.paths {
+		if err := os.WriteFile(p, s.data[p], s.modes[p]); err != nil {
+			errs = append(errs, fmt.Errorf("restore %s: %w", p, err))
+		}
+	}
+	return errors.Join(errs...)
+}
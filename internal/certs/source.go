@@ -0,0 +1,312 @@
+package certs
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Files are the PEM files of one certificate as found by a Source.
+type Files struct {
+	// Name is what the certificate is known by locally, usually its directory
+	// or primary domain; it is used to name uploads.
+	Name      string
+	KeyPath   string
+	ChainPath string
+}
+
+// Source locates the current key and fullchain files of a certificate written
+// by some ACME client.
+type Source interface {
+	Locate() (Files, error)
+	String() string
+}
+
+// CertbotArchive picks the highest numbered privkeyN.pem/fullchainN.pem pair
+// in Dir/<Domain>, the layout of certbot's archive directory and of the
+// built-in ACME client. Without Domain (or when it has no such files) every
+// subdirectory is a candidate, see chooseSubdir.
+type CertbotArchive struct {
+	Dir    string
+	Domain string
+	// Hosts and Explain drive the choice among subdirectories.
+	Hosts   []string
+	Explain func(Candidate)
+}
+
+func (s *CertbotArchive) String() string { return "certbot " + filepath.Join(s.Dir, s.Domain) }
+
+func (s *CertbotArchive) Locate() (Files, error) {
+	if s.Domain != "" {
+		if f, err := s.locate(s.Domain); err == nil {
+			return f, nil
+		}
+	}
+	return chooseSubdir(s.Dir, s.Hosts, s.Explain, s.locate)
+}
+
+func (s *CertbotArchive) locate(name string) (Files, error) {
+	key, chain, err := pickNumbered(filepath.Join(s.Dir, name))
+	if err != nil {
+		return Files{}, err
+	}
+	return Files{Name: name, KeyPath: key, ChainPath: chain}, nil
+}
+
+// CertbotLive uses the privkey.pem/fullchain.pem symlinks certbot maintains in
+// Dir/<Domain>. Without Domain every subdirectory is a candidate, see
+// chooseSubdir.
+type CertbotLive struct {
+	Dir     string
+	Domain  string
+	Hosts   []string
+	Explain func(Candidate)
+}
+
+func (s *CertbotLive) String() string { return "certbot-live " + filepath.Join(s.Dir, s.Domain) }
+
+func (s *CertbotLive) Locate() (Files, error) {
+	if s.Domain != "" {
+		return s.locate(s.Domain)
+	}
+	return chooseSubdir(s.Dir, s.Hosts, s.Explain, s.locate)
+}
+
+func (s *CertbotLive) locate(name string) (Files, error) {
+	d := filepath.Join(s.Dir, name)
+	return existing(Files{Name: name, KeyPath: filepath.Join(d, "privkey.pem"), ChainPath: filepath.Join(d, "fullchain.pem")})
+}
+
+// AcmeSh reads acme.sh's Home/<Domain>/<Domain>.key and fullchain.cer. ECC
+// certificates live in <Domain>_ecc; when both exist the newer one wins.
+type AcmeSh struct {
+	// Home defaults to ~/.acme.sh.
+	Home   string
+	Domain string
+}
+
+func (s *AcmeSh) String() string { return "acme.sh " + filepath.Join(s.home(), s.Domain) }
+
+func (s *AcmeSh) home() string {
+	if s.Home != "" {
+		return s.Home
+	}
+	if h, err := os.UserHomeDir(); err == nil {
+		return filepath.Join(h, ".acme.sh")
+	}
+	return ".acme.sh"
+}
+
+func (s *AcmeSh) Locate() (Files, error) {
+	if s.Domain == "" {
+		return Files{}, fmt.Errorf("acme.sh: domain is required")
+	}
+	var found []Files
+	var mtimes []time.Time
+	for _, dir := range []string{s.Domain, s.Domain + "_ecc"} {
+		d := filepath.Join(s.home(), dir)
+		f := Files{Name: s.Domain, KeyPath: filepath.Join(d, s.Domain+".key"), ChainPath: filepath.Join(d, "fullchain.cer")}
+		fi, err := os.Stat(f.ChainPath)
+		if err != nil {
+			continue
+		}
+		if _, err := os.Stat(f.KeyPath); err != nil {
+			continue
+		}
+		found = append(found, f)
+		mtimes = append(mtimes, fi.ModTime())
+	}
+	switch {
+	case len(found) == 0:
+		return Files{}, fmt.Errorf("acme.sh: no certificate for %s under %s", s.Domain, s.home())
+	case len(found) == 2 && mtimes[1].After(mtimes[0]):
+		return found[1], nil
+	}
+	return found[0], nil
+}
+
+// Lego reads Path/certificates/<Domain>.key and <Domain>.crt (which lego
+// writes with the issuer bundled). Path may also point at the certificates
+// directory itself; it defaults to ./.lego. Wildcard names are stored with
+// "*" replaced by "_".
+type Lego struct {
+	Path   string
+	Domain string
+}
+
+func (s *Lego) String() string { return "lego " + s.dir() }
+
+func (s *Lego) dir() string {
+	p := s.Path
+	if p == "" {
+		p = ".lego"
+	}
+	if fi, err := os.Stat(filepath.Join(p, "certificates")); err == nil && fi.IsDir() {
+		return filepath.Join(p, "certificates")
+	}
+	return p
+}
+
+func (s *Lego) Locate() (Files, error) {
+	if s.Domain == "" {
+		return Files{}, fmt.Errorf("lego: domain is required")
+	}
+	base := strings.ReplaceAll(s.Domain, "*", "_")
+	d := s.dir()
+	return existing(Files{Name: s.Domain, KeyPath: filepath.Join(d, base+".key"), ChainPath: filepath.Join(d, base+".crt")})
+}
+
+// Explicit is a fixed key and fullchain path pair.
+type Explicit struct {
+	Name      string
+	KeyPath   string
+	ChainPath string
+}
+
+func (s *Explicit) String() string { return "files " + s.ChainPath }
+
+func (s *Explicit) Locate() (Files, error) {
+	name := s.Name
+	if name == "" {
+		name = strings.TrimSuffix(filepath.Base(s.ChainPath), filepath.Ext(s.ChainPath))
+	}
+	return existing(Files{Name: name, KeyPath: s.KeyPath, ChainPath: s.ChainPath})
+}
+
+func existing(f Files) (Files, error) {
+	for _, p := range []string{f.KeyPath, f.ChainPath} {
+		if _, err := os.Stat(p); err != nil {
+			return Files{}, err
+		}
+	}
+	return f, nil
+}
+
+// Candidate is one certificate considered by chooseSubdir.
+type Candidate struct {
+	Files
+	NotAfter time.Time
+	// Err says why the candidate was rejected; nil means it qualified.
+	Err      error
+	Selected bool
+}
+
+// chooseSubdir looks at the certificate in every subdirectory of dir and
+// picks, among those covering all hosts, the one with the latest NotAfter.
+// Directory timestamps are ignored: an unrelated site renewed last must not
+// win. explain, if set, is called for every candidate once the choice is made.
+func chooseSubdir(dir string, hosts []string, explain func(Candidate), locate func(name string) (Files, error)) (Files, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return Files{}, err
+	}
+	var cands []Candidate
+	best := -1
+	for _, e := range entries {
+		if !e.IsDir() {
+			continue
+		}
+		c := Candidate{Files: Files{Name: e.Name()}}
+		if f, err := locate(e.Name()); err != nil {
+			c.Err = err
+		} else {
+			c.Files = f
+			c.NotAfter, c.Err = inspect(f.ChainPath, hosts)
+		}
+		if c.Err == nil && (best < 0 || c.NotAfter.After(cands[best].NotAfter)) {
+			best = len(cands)
+		}
+		cands = append(cands, c)
+	}
+	if best >= 0 {
+		cands[best].Selected = true
+	}
+	if explain != nil {
+		for _, c := range cands {
+			explain(c)
+		}
+	}
+	switch {
+	case len(cands) == 0:
+		return Files{}, fmt.Errorf("no certificate directories under %s", dir)
+	case best < 0:
+		return Files{}, fmt.Errorf("no certificate under %s covers %s", dir, strings.Join(hosts, ","))
+	}
+	return cands[best].Files, nil
+}
+
+// inspect returns the leaf's NotAfter, or why the leaf in chainPath cannot
+// serve hosts.
+func inspect(chainPath string, hosts []string) (time.Time, error) {
+	leaf, err := LoadLeaf(chainPath)
+	if err != nil {
+		return time.Time{}, err
+	}
+	var missing []string
+	for _, h := range hosts {
+		if h != "" && !strings.HasPrefix(h, ".") && !Covers(leaf, h) {
+			missing = append(missing, h)
+		}
+	}
+	if len(missing) > 0 {
+		return leaf.NotAfter, fmt.Errorf("SANs %s do not cover %s", strings.Join(leaf.DNSNames, ","), strings.Join(missing, ","))
+	}
+	return leaf.NotAfter, nil
+}
+
+var (
+	rePrivkey   = regexp.MustCompile(`^privkey(\d*)\.pem$`)
+	reFullchain = regexp.MustCompile(`^fullchain(\d*)\.pem$`)
+)
+
+// pickNumbered returns the highest numbered key/fullchain pair in dir, or the
+// highest of each when no number has both.
+func pickNumbered(dir string) (privPath string, fullchainPath string, err error) {
+	privs := make(map[int]string)
+	fulls := make(map[int]string)
+	ents, err := os.ReadDir(dir)
+	if err != nil {
+		return "", "", err
+	}
+	for _, e := range ents {
+		if e.IsDir() {
+			continue
+		}
+		name := e.Name()
+		if m := rePrivkey.FindStringSubmatch(name); m != nil {
+			n, _ := strconv.Atoi(m[1])
+			privs[n] = filepath.Join(dir, name)
+		} else if m := reFullchain.FindStringSubmatch(name); m != nil {
+			n, _ := strconv.Atoi(m[1])
+			fulls[n] = filepath.Join(dir, name)
+		}
+	}
+	if len(privs) == 0 || len(fulls) == 0 {
+		return "", "", fmt.Errorf("no numbered cert files under %s", dir)
+	}
+	best := -1
+	for n := range privs {
+		if _, ok := fulls[n]; ok && n > best {
+			best = n
+		}
+	}
+	if best >= 0 {
+		return privs[best], fulls[best], nil
+	}
+	largestPriv, largestFull := -1, -1
+	for n := range privs {
+		if n > largestPriv {
+			largestPriv = n
+		}
+	}
+	for n := range fulls {
+		if n > largestFull {
+			largestFull = n
+		}
+	}
+	return privs[largestPriv], fulls[largestFull], nil
+}
@@ -0,0 +1,270 @@
+package certs
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAcmeShPicksNewer(t *testing.T) {
+	home := t.TempDir()
+	old := time.Now().Add(-48 * time.Hour)
+	touch := func(dir string, mtime time.Time) {
+		writeFile(t, filepath.Join(home, dir), "example.com.key", []byte("key"))
+		chain := writeFile(t, filepath.Join(home, dir), "fullchain.cer", []byte("chain"))
+		if err := os.Chtimes(chain, mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
+	}
+	s := &AcmeSh{Home: home, Domain: "example.com"}
+
+	touch("example.com_ecc", old)
+	f, err := s.Locate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := filepath.Join(home, "example.com_ecc", "fullchain.cer"); f.ChainPath != want {
+		t.Errorf("only ECC: chain %s, want %s", f.ChainPath, want)
+	}
+
+	touch("example.com", old.Add(time.Hour))
+	if f, err = s.Locate(); err != nil {
+		t.Fatal(err)
+	}
+	if want := filepath.Join(home, "example.com", "example.com.key"); f.KeyPath != want || f.Name != "example.com" {
+		t.Errorf("RSA newer: %+v, want key %s", f, want)
+	}
+
+	touch("example.com_ecc", old.Add(2*time.Hour))
+	if f, err = s.Locate(); err != nil {
+		t.Fatal(err)
+	}
+	if want := filepath.Join(home, "example.com_ecc", "example.com.key"); f.KeyPath != want {
+		t.Errorf("ECC newer: key %s, want %s", f.KeyPath, want)
+	}
+}
+
+func TestLegoWildcardFileNames(t *testing.T) {
+	root := t.TempDir()
+	certDir := filepath.Join(root, "certificates")
+	writeFile(t, certDir, "_.example.com.key", []byte("key"))
+	writeFile(t, certDir, "_.example.com.crt", []byte("chain"))
+
+	// Path may be the lego directory or its certificates directory
+	for _, path := range []string{root, certDir} {
+		f, err := (&Lego{Path: path, Domain: "*.example.com"}).Locate()
+		if err != nil {
+			t.Fatalf("%s: %v", path, err)
+		}
+		want := Files{
+			Name:      "*.example.com",
+			KeyPath:   filepath.Join(certDir, "_.example.com.key"),
+			ChainPath: filepath.Join(certDir, "_.example.com.crt"),
+		}
+		if f != want {
+			t.Errorf("%s: %+v, want %+v", path, f, want)
+		}
+	}
+}
+
+func TestCertbotLiveFollowsSymlinks(t *testing.T) {
+	root := t.TempDir()
+	archive := filepath.Join(root, "archive", "example.com")
+	live := filepath.Join(root, "live", "example.com")
+	writeFile(t, archive, "privkey1.pem", []byte("key1"))
+	writeFile(t, archive, "fullchain1.pem", []byte("chain1"))
+	writeFile(t, archive, "privkey2.pem", []byte("key2"))
+	writeFile(t, archive, "fullchain2.pem", []byte("chain2"))
+	if err := os.MkdirAll(live, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	// certbot links relative to the live directory
+	for link, target := range map[string]string{"privkey.pem": "privkey2.pem", "fullchain.pem": "fullchain2.pem"} {
+		if err := os.Symlink(filepath.Join("..", "..", "archive", "example.com", target), filepath.Join(live, link)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	f, err := (&CertbotLive{Dir: filepath.Join(root, "live"), Domain: "example.com"}).Locate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for path, want := range map[string]string{f.KeyPath: "key2", f.ChainPath: "chain2"} {
+		if b, err := os.ReadFile(path); err != nil || string(b) != want {
+			t.Errorf("%s = %q, %v; want %q", path, b, err, want)
+		}
+	}
+
+	// a dangling link, e.g. after the archive was pruned, is an error
+	if err := os.Remove(filepath.Join(archive, "fullchain2.pem")); err != nil {
+		t.Fatal(err)
+	}
+	if f, err := (&CertbotLive{Dir: filepath.Join(root, "live"), Domain: "example.com"}).Locate(); err == nil {
+		t.Errorf("dangling symlink located: %+v", f)
+	}
+}
+
+func TestCertbotArchiveHighestNumber(t *testing.T) {
+	dir := t.TempDir()
+	d := filepath.Join(dir, "example.com")
+	for _, name := range []string{"privkey1.pem", "fullchain1.pem", "privkey2.pem", "fullchain2.pem", "privkey10.pem", "fullchain10.pem", "privkey11.pem"} {
+		writeFile(t, d, name, []byte(name))
+	}
+	f, err := (&CertbotArchive{Dir: dir, Domain: "example.com"}).Locate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.KeyPath != filepath.Join(d, "privkey10.pem") || f.ChainPath != filepath.Join(d, "fullchain10.pem") {
+		t.Errorf("picked %s and %s, want the highest complete pair 10", f.KeyPath, f.ChainPath)
+	}
+}
+
+func TestSourcesMissingFiles(t *testing.T) {
+	dir := t.TempDir()
+	// the key exists, the chain does not
+	writeFile(t, filepath.Join(dir, "example.com"), "privkey.pem", []byte("key"))
+	writeFile(t, filepath.Join(dir, "example.com"), "example.com.key", []byte("key"))
+	writeFile(t, filepath.Join(dir, "certificates"), "example.com.key", []byte("key"))
+
+	sources := []Source{
+		&CertbotArchive{Dir: dir, Domain: "example.com"},
+		&CertbotArchive{Dir: filepath.Join(dir, "missing")},
+		&CertbotLive{Dir: dir, Domain: "example.com"},
+		&AcmeSh{Home: dir, Domain: "example.com"},
+		&AcmeSh{Home: dir},
+		&Lego{Path: dir, Domain: "example.com"},
+		&Lego{Path: dir},
+		&Explicit{KeyPath: filepath.Join(dir, "example.com", "privkey.pem"), ChainPath: filepath.Join(dir, "example.com", "fullchain.pem")},
+	}
+	for _, s := range sources {
+		f, err := s.Locate()
+		if err == nil {
+			t.Errorf("%s: located %+v", s, f)
+		}
+		if f != (Files{}) {
+			t.Errorf("%s: returned %+v with the error", s, f)
+		}
+	}
+}
+
+func TestChooseSubdir(t *testing.T) {
+	ca := newTestCA(t, "root", nil)
+	now := time.Now()
+	day := 24 * time.Hour
+	type dir struct {
+		name     string
+		names    []string
+		notAfter time.Duration
+		// mtime is the directory timestamp relative to now, which must not
+		// matter
+		mtime time.Duration
+	}
+	tests := []struct {
+		name  string
+		dirs  []dir
+		hosts []string
+		want  string
+		// rejected are the directories explained with an error
+		rejected []string
+	}{
+		{
+			name: "newer directory without the SAN loses",
+			dirs: []dir{
+				{"www", []string{"www.example.com"}, 60 * day, -10 * day},
+				{"other", []string{"other.example.org"}, 89 * day, 0},
+			},
+			hosts:    []string{"www.example.com"},
+			want:     "www",
+			rejected: []string{"other"},
+		},
+		{
+			name: "latest NotAfter among covering certificates",
+			dirs: []dir{
+				{"a", []string{"www.example.com"}, 30 * day, 0},
+				{"b", []string{"example.com", "www.example.com"}, 80 * day, -20 * day},
+				{"c", []string{"*.example.com"}, 50 * day, -1 * day},
+			},
+			hosts: []string{"www.example.com"},
+			want:  "b",
+		},
+		{
+			name: "wildcard covers one label only",
+			dirs: []dir{
+				{"wild", []string{"*.example.com"}, 89 * day, 0},
+				{"deep", []string{"a.b.example.com"}, 10 * day, -5 * day},
+			},
+			hosts:    []string{"a.b.example.com"},
+			want:     "deep",
+			rejected: []string{"wild"},
+		},
+		{
+			name: "every host must be covered",
+			dirs: []dir{
+				{"www", []string{"www.example.com"}, 89 * day, 0},
+				{"both", []string{"www.example.com", "img.example.com"}, 10 * day, -5 * day},
+			},
+			hosts:    []string{"www.example.com", "img.example.com", ".example.com"},
+			want:     "both",
+			rejected: []string{"www"},
+		},
+	}
+	for _, tt := range tests {
+		live := t.TempDir()
+		for _, d := range tt.dirs {
+			key, chain := ca.issue(t, now.Add(-day), now.Add(d.notAfter), d.names...)
+			writeFile(t, filepath.Join(live, d.name), "privkey.pem", key)
+			writeFile(t, filepath.Join(live, d.name), "fullchain.pem", chain)
+			mtime := now.Add(d.mtime)
+			if err := os.Chtimes(filepath.Join(live, d.name), mtime, mtime); err != nil {
+				t.Fatal(err)
+			}
+		}
+		// not a certificate directory
+		writeFile(t, live, "README", []byte("certbot"))
+
+		var explained []Candidate
+		s := &CertbotLive{Dir: live, Hosts: tt.hosts, Explain: func(c Candidate) { explained = append(explained, c) }}
+		f, err := s.Locate()
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if f.Name != tt.want {
+			t.Errorf("%s: chose %s, want %s", tt.name, f.Name, tt.want)
+		}
+		if len(explained) != len(tt.dirs) {
+			t.Fatalf("%s: explained %d candidates, want %d", tt.name, len(explained), len(tt.dirs))
+		}
+		var rejected []string
+		for _, c := range explained {
+			if c.Selected != (c.Name == tt.want) {
+				t.Errorf("%s: %s selected = %v", tt.name, c.Name, c.Selected)
+			}
+			if c.Err != nil {
+				rejected = append(rejected, c.Name)
+			}
+		}
+		if !slices.Equal(rejected, tt.rejected) {
+			t.Errorf("%s: rejected %v, want %v", tt.name, rejected, tt.rejected)
+		}
+	}
+}
+
+func TestChooseSubdirNoneCovers(t *testing.T) {
+	ca := newTestCA(t, "root", nil)
+	live := t.TempDir()
+	key, chain := ca.issue(t, time.Now(), time.Now().Add(time.Hour), "*.example.com")
+	writeFile(t, filepath.Join(live, "wild"), "privkey.pem", key)
+	writeFile(t, filepath.Join(live, "wild"), "fullchain.pem", chain)
+	writeFile(t, filepath.Join(live, "empty"), "README", nil)
+
+	_, err := (&CertbotLive{Dir: live, Hosts: []string{"example.com"}}).Locate()
+	if err == nil || !strings.Contains(err.Error(), "covers example.com") {
+		t.Errorf("error = %v", err)
+	}
+	if _, err := (&CertbotLive{Dir: t.TempDir()}).Locate(); err == nil {
+		t.Error("located a certificate in an empty directory")
+	}
+}
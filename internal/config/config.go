@@ -0,0 +1,270 @@
+package config
+
+import (
+	"fmt"
+
+	"github.com/BurntSushi/toml"
+)
+
+type Config struct {
+	ACME     ACME   `toml:"acme"`
+	Daemon   Daemon `toml:"daemon"`
+	Defaults Job    `toml:"defaults"`
+	Jobs     []Job  `toml:"job"`
+}
+
+// Daemon configures `rotate-cert daemon`. Durations use time.ParseDuration syntax.
+type Daemon struct {
+	Interval string `toml:"interval"`
+	Jitter   string `toml:"jitter"`
+	Listen   string `toml:"listen"`
+}
+
+// ACME holds account settings shared by every job that uses the built-in client.
+type ACME struct {
+	Directory  string `toml:"directory"`
+	Email      string `toml:"email"`
+	AccountKey string `toml:"account_key"`
+	CA         string `toml:"ca"`
+	DNSServer  string `toml:"dns_server"`
+}
+
+// Job describes one certificate: which records to swap, where the
+// certificate comes from and where it is deployed.
+type Job struct {
+	Name string `toml:"name"`
+
+	// DNS swap targets
+	Domain string `toml:"domain"`
+	RRA    string `toml:"rr_a"`
+	RRB    string `toml:"rr_b"`
+	Type   string `toml:"type"`
+	ValueA string `toml:"value_a"`
+	ValueB string `toml:"value_b"`
+
+	// certificate source
+	CertDomain  string `toml:"cert_domain"`
+	CertbotLive string `toml:"certbot_live"`
+	// CertSource selects where the key and fullchain are read from; CertDir,
+	// CertFile and KeyFile are its location for the non-certbot layouts.
+	CertSource    string   `toml:"cert_source"`
+	CertDir       string   `toml:"cert_dir"`
+	CertFile      string   `toml:"cert_file"`
+	KeyFile       string   `toml:"key_file"`
+	Renewer       string   `toml:"renewer"`
+	ACMEChallenge string   `toml:"acme_challenge"`
+	ACMEWebroot   string   `toml:"acme_webroot"`
+	ACMEDomains   []string `toml:"acme_domains"`
+	RenewBefore   string   `toml:"renew_before"`
+	// Force, QiniuOnly, QiniuMatchSANs and NginxRestore are pointers so a
+	// job can turn off a switch enabled in [defaults]; read them with On.
+	Force     *bool  `toml:"force"`
+	QiniuOnly *bool  `toml:"qiniu_only"`
+	State     string `toml:"state"`
+	// TrustedCA is a PEM file of roots the certificate chain must verify
+	// against instead of the system pool, e.g. a staging or private CA.
+	TrustedCA string `toml:"trusted_ca"`
+
+	// deploy targets
+	QiniuDomains []string `toml:"qiniu_domains"`
+	Nginx        string   `toml:"nginx"`
+	Reload       []string `toml:"reload"`
+	// ReloadTest runs before custom reload commands; the default reload is
+	// always preceded by nginx -t.
+	ReloadTest []string `toml:"reload_test"`
+	// NginxCheck lists host[:port][/sni] endpoints that must serve the new
+	// certificate within NginxCheckTimeout after reload.
+	NginxCheck        []string `toml:"nginx_check"`
+	NginxCheckTimeout string   `toml:"nginx_check_timeout"`
+	// NginxRestore writes the previous certificate files back and reloads
+	// again when a check fails.
+	NginxRestore *bool `toml:"nginx_restore"`
+	// Deploy is the ordered list of deploy targets. Empty means nginx
+	// (unless qiniu_only) followed by qiniu.
+	Deploy []Deploy `toml:"deploy"`
+	// QiniuPruneKeep > 0 deletes older unbound Qiniu certificates of the same
+	// common name after a successful bind, keeping this many.
+	QiniuPruneKeep int `toml:"qiniu_prune_keep"`
+	// QiniuForceHTTPS and QiniuHTTP2 override the domain's current HTTPS
+	// switches when set; otherwise only the certificate is changed.
+	QiniuForceHTTPS *bool `toml:"qiniu_force_https"`
+	QiniuHTTP2      *bool `toml:"qiniu_http2"`
+	// QiniuMatchSANs adds every Qiniu CDN domain covered by the
+	// certificate's SANs to the bind targets.
+	QiniuMatchSANs *bool `toml:"qiniu_match_sans"`
+	// QiniuVerifyTimeout bounds waiting for the bind to take effect and the
+	// new certificate to be served; "0" skips verification.
+	QiniuVerifyTimeout string `toml:"qiniu_verify_timeout"`
+}
+
+const (
+	RenewerCertbot = "certbot"
+	RenewerACME    = "acme"
+	RenewerNone    = "none"
+)
+
+// Deploy is one target in a job's deploy list. Nginx and Qiniu targets take
+// their settings from the job; command targets run the shell hooks below with
+// the certificate described in CERT_* environment variables.
+type Deploy struct {
+	Type string `toml:"type"`
+	// Name labels the target in output and defaults to Type.
+	Name     string `toml:"name"`
+	Prepare  string `toml:"prepare"`
+	Command  string `toml:"command"`
+	Verify   string `toml:"verify"`
+	Rollback string `toml:"rollback"`
+
+	// Domains are the Alibaba Cloud CDN/DCDN domains to deploy to; empty
+	// means the job's target domains.
+	Domains []string `toml:"domains"`
+	// Endpoint overrides the product's OpenAPI endpoint.
+	Endpoint string `toml:"endpoint"`
+	// VerifyTimeout bounds waiting for the new certificate to take effect;
+	// "0" skips verification.
+	VerifyTimeout string `toml:"verify_timeout"`
+	// PruneKeep > 0 deletes older Certificate Management Service uploads
+	// with the same common name once every target succeeded, keeping this
+	// many.
+	PruneKeep int `toml:"prune_keep"`
+	// Region and Listeners ("<load balancer ID>:<port>") select the HTTPS
+	// listeners of Alibaba Cloud SLB/ALB targets.
+	Region    string   `toml:"region"`
+	Listeners []string `toml:"listeners"`
+}
+
+const (
+	DeployNginx      = "nginx"
+	DeployQiniu      = "qiniu"
+	DeployCommand    = "command"
+	DeployAliyunCDN  = "aliyun-cdn"
+	DeployAliyunDCDN = "aliyun-dcdn"
+	DeployAliyunCAS  = "aliyun-cas"
+	DeployAliyunSLB  = "aliyun-slb"
+	DeployAliyunALB  = "aliyun-alb"
+)
+
+// Certificate layouts understood by CertSource.
+const (
+	SourceCertbot     = "certbot"
+	SourceCertbotLive = "certbot-live"
+	SourceAcmeSh      = "acme.sh"
+	SourceLego        = "lego"
+	SourceFiles       = "files"
+)
+
+// Load reads a TOML config and fills unset job fields from [defaults].
+func Load(path string) (*Config, error) {
+	cfg := &Config{}
+	md, err := toml.DecodeFile(path, cfg)
+	if err != nil {
+		return nil, err
+	}
+	if undecoded := md.Undecoded(); len(undecoded) > 0 {
+		return nil, fmt.Errorf("%s: unknown keys %v", path, undecoded)
+	}
+	if len(cfg.Jobs) == 0 {
+		return nil, fmt.Errorf("%s: no [[job]] defined", path)
+	}
+	for i := range cfg.Jobs {
+		j := &cfg.Jobs[i]
+		j.ApplyDefaults(cfg.Defaults)
+		if j.Name == "" {
+			j.Name = j.DefaultName()
+		}
+	}
+	return cfg, nil
+}
+
+// DefaultName names a job after its certificate domain, or rr_a.domain.
+func (j *Job) DefaultName() string {
+	if j.CertDomain != "" {
+		return j.CertDomain
+	}
+	return j.RRA + "." + j.Domain
+}
+
+// DefaultRenewer is the renewer used when none is configured: certbot for
+// the certbot layouts, none for acme.sh, lego and hand-managed files, which
+// are renewed by their own tooling.
+func (j *Job) DefaultRenewer() string {
+	if j.CertSource == "" || j.CertSource == SourceCertbot || j.CertSource == SourceCertbotLive {
+		return RenewerCertbot
+	}
+	return RenewerNone
+}
+
+// ApplyDefaults copies every empty field of j from d, then applies the
+// built-in defaults used by the command line flags.
+func (j *Job) ApplyDefaults(d Job) {
+	str := func(dst *string, vals ...string) {
+		for _, v := range vals {
+			if *dst != "" {
+				return
+			}
+			*dst = v
+		}
+	}
+	list := func(dst *[]string, v []string) {
+		if len(*dst) == 0 {
+			*dst = v
+		}
+	}
+	str(&j.Domain, d.Domain)
+	str(&j.RRA, d.RRA, "a")
+	str(&j.RRB, d.RRB, "b")
+	str(&j.Type, d.Type)
+	str(&j.CertbotLive, d.CertbotLive, "/etc/letsencrypt/live")
+	str(&j.CertSource, d.CertSource, SourceCertbot)
+	str(&j.Renewer, d.Renewer, j.DefaultRenewer())
+	str(&j.CertDir, d.CertDir)
+	str(&j.ACMEChallenge, d.ACMEChallenge, "http-01")
+	str(&j.ACMEWebroot, d.ACMEWebroot, "/usr/local/nginx/html")
+	list(&j.ACMEDomains, d.ACMEDomains)
+	str(&j.RenewBefore, d.RenewBefore, "33%")
+	str(&j.State, d.State, "./state/state.json")
+	str(&j.TrustedCA, d.TrustedCA)
+	list(&j.QiniuDomains, d.QiniuDomains)
+	str(&j.Nginx, d.Nginx, "/usr/local/nginx/sbin/nginx")
+	list(&j.Reload, d.Reload)
+	list(&j.ReloadTest, d.ReloadTest)
+	list(&j.NginxCheck, d.NginxCheck)
+	str(&j.NginxCheckTimeout, d.NginxCheckTimeout, "1m")
+	if len(j.Deploy) == 0 {
+		j.Deploy = d.Deploy
+	}
+	str(&j.QiniuVerifyTimeout, d.QiniuVerifyTimeout, "10m")
+	if j.QiniuPruneKeep == 0 {
+		j.QiniuPruneKeep = d.QiniuPruneKeep
+	}
+	boolean := func(dst **bool, v *bool) {
+		if *dst == nil {
+			*dst = v
+		}
+	}
+	boolean(&j.QiniuForceHTTPS, d.QiniuForceHTTPS)
+	boolean(&j.QiniuHTTP2, d.QiniuHTTP2)
+	boolean(&j.Force, d.Force)
+	boolean(&j.QiniuOnly, d.QiniuOnly)
+	boolean(&j.QiniuMatchSANs, d.QiniuMatchSANs)
+	boolean(&j.NginxRestore, d.NginxRestore)
+}
+
+// On reports whether an optional switch is set and true.
+func On(b *bool) bool {
+	return b != nil && *b
+}
+
+// Bool returns a pointer to v for setting an optional switch.
+func Bool(v bool) *bool {
+	return &v
+}
+
+func (a *ACME) ApplyDefaults(directory string) {
+	if a.Directory == "" {
+		a.Directory = directory
+	}
+	if a.AccountKey == "" {
+		a.AccountKey = "./state/acme-account.key"
+	}
+}
@@ -0,0 +1,112 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadRenewerDefaults(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rotate.toml")
+	err := os.WriteFile(path, []byte(`
+[defaults]
+domain = "example.com"
+
+[[job]]
+cert_domain = "www.example.com"
+
+[[job]]
+cert_domain = "img.example.com"
+cert_source = "lego"
+
+[[job]]
+cert_domain = "api.example.com"
+cert_source = "files"
+cert_file = "/etc/ssl/api.pem"
+key_file = "/etc/ssl/api.key"
+renewer = "certbot"
+
+[[job]]
+cert_domain = "live.example.com"
+cert_source = "certbot-live"
+`), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{
+		"www.example.com":  RenewerCertbot,
+		"img.example.com":  RenewerNone,
+		"api.example.com":  RenewerCertbot,
+		"live.example.com": RenewerCertbot,
+	}
+	for _, j := range cfg.Jobs {
+		if j.Renewer != want[j.Name] {
+			t.Errorf("job %s: renewer %q, want %q", j.Name, j.Renewer, want[j.Name])
+		}
+		if j.Domain != "example.com" {
+			t.Errorf("job %s: domain %q not taken from [defaults]", j.Name, j.Domain)
+		}
+	}
+}
+
+func TestLoadRejectsUnknownKeys(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rotate.toml")
+	if err := os.WriteFile(path, []byte("[[job]]\ncert_domian = \"x\"\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Load(path); err == nil {
+		t.Error("misspelled key accepted")
+	}
+}
+
+func TestLoadInheritsSwitches(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rotate.toml")
+	err := os.WriteFile(path, []byte(`
+[defaults]
+force = true
+qiniu_only = true
+qiniu_match_sans = true
+nginx_restore = true
+qiniu_http2 = true
+
+[[job]]
+name = "inherit"
+
+[[job]]
+name = "override"
+force = false
+qiniu_only = false
+qiniu_match_sans = false
+nginx_restore = false
+qiniu_http2 = false
+`), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, j := range cfg.Jobs {
+		want := j.Name == "inherit"
+		got := map[string]*bool{
+			"force":            j.Force,
+			"qiniu_only":       j.QiniuOnly,
+			"qiniu_match_sans": j.QiniuMatchSANs,
+			"nginx_restore":    j.NginxRestore,
+			"qiniu_http2":      j.QiniuHTTP2,
+		}
+		for key, v := range got {
+			if v == nil || *v != want {
+				t.Errorf("job %s: %s = %v, want %v", j.Name, key, On(v), want)
+			}
+		}
+		if j.QiniuForceHTTPS != nil {
+			t.Errorf("job %s: qiniu_force_https set without being configured", j.Name)
+		}
+	}
+}
@@ -0,0 +1,191 @@
+package dns
+
+import (
+	"context"
+
+	alidns20150109 "github.com/alibabacloud-go/alidns-20150109/v5/client"
+	util "github.com/alibabacloud-go/tea-utils/v2/service"
+	"github.com/alibabacloud-go/tea/tea"
+
+	"auto-https/internal/aliyun"
+	"auto-https/internal/retry"
+)
+
+const (
+	aliyunEndpoint = "alidns.cn-hangzhou.aliyuncs.com"
+
+	// AliyunMaxPageSize is the largest PageSize DescribeDomainRecords accepts.
+	AliyunMaxPageSize = 500
+)
+
+type Aliyun struct {
+	client *alidns20150109.Client
+	// PageSize is the number of records requested per DescribeDomainRecords
+	// call; values outside 1..AliyunMaxPageSize fall back to the maximum.
+	PageSize int64
+	// Retry applies to every call except AddDomainRecord, which is not
+	// idempotent.
+	Retry retry.Policy
+}
+
+func NewAliyun(accessKeyId, accessKeySecret string) (*Aliyun, error) {
+	client, err := alidns20150109.NewClient(aliyun.Config(accessKeyId, accessKeySecret, aliyunEndpoint))
+	if err != nil {
+		return nil, err
+	}
+	return &Aliyun{client: client, PageSize: AliyunMaxPageSize, Retry: retry.Default}, nil
+}
+
+func (p *Aliyun) ListRecords(ctx context.Context, domain string) ([]Record, error) {
+	return p.describe(ctx, &alidns20150109.DescribeDomainRecordsRequest{
+		DomainName: tea.String(domain),
+	})
+}
+
+func (p *Aliyun) FindRecord(ctx context.Context, domain, rr, typ, value string) (*Record, error) {
+	req := &alidns20150109.DescribeDomainRecordsRequest{
+		DomainName: tea.String(domain),
+		RRKeyWord:  tea.String(rr),
+	}
+	if typ != "" {
+		req.TypeKeyWord = tea.String(typ)
+	}
+	records, err := p.describe(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	return MatchRecord(records, rr, typ, value), nil
+}
+
+func (p *Aliyun) describe(ctx context.Context, req *alidns20150109.DescribeDomainRecordsRequest) ([]Record, error) {
+	pageSize := p.PageSize
+	if pageSize <= 0 || pageSize > AliyunMaxPageSize {
+		pageSize = AliyunMaxPageSize
+	}
+	req.PageSize = tea.Int64(pageSize)
+	var records []Record
+	for page := int64(1); ; page++ {
+		req.PageNumber = tea.Int64(page)
+		var resp *alidns20150109.DescribeDomainRecordsResponse
+		err := p.do(ctx, "DescribeDomainRecords", func(runtime *util.RuntimeOptions) (err error) {
+			resp, err = p.client.DescribeDomainRecordsWithOptions(req, runtime)
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+		if resp == nil || resp.Body == nil || resp.Body.DomainRecords == nil {
+			break
+		}
+		got := resp.Body.DomainRecords.Record
+		for _, r := range got {
+			records = append(records, Record{
+				ID:       tea.StringValue(r.RecordId),
+				RR:       tea.StringValue(r.RR),
+				Type:     tea.StringValue(r.Type),
+				Value:    tea.StringValue(r.Value),
+				TTL:      tea.Int64Value(r.TTL),
+				Priority: tea.Int64Value(r.Priority),
+				Line:     tea.StringValue(r.Line),
+				Status:   tea.StringValue(r.Status),
+			})
+		}
+		total := tea.Int64Value(resp.Body.TotalCount)
+		if len(got) == 0 || int64(len(got)) < pageSize || (total > 0 && int64(len(records)) >= total) {
+			break
+		}
+	}
+	return records, nil
+}
+
+func (p *Aliyun) AddRecord(ctx context.Context, domain string, r Record) (string, error) {
+	req := &alidns20150109.AddDomainRecordRequest{
+		DomainName: tea.String(domain),
+		RR:         tea.String(r.RR),
+		Type:       tea.String(r.Type),
+		Value:      tea.String(r.Value),
+	}
+	if r.TTL > 0 {
+		req.TTL = tea.Int64(r.TTL)
+	}
+	if r.Priority > 0 {
+		req.Priority = tea.Int64(r.Priority)
+	}
+	if r.Line != "" {
+		req.Line = tea.String(r.Line)
+	}
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	resp, err := p.client.AddDomainRecordWithOptions(req, aliyun.RuntimeOptions(ctx, p.Retry.Timeout))
+	if err != nil {
+		return "", err
+	}
+	if resp == nil || resp.Body == nil {
+		return "", nil
+	}
+	return tea.StringValue(resp.Body.RecordId), nil
+}
+
+func (p *Aliyun) UpdateRecord(ctx context.Context, r Record) error {
+	req := &alidns20150109.UpdateDomainRecordRequest{
+		RecordId: tea.String(r.ID),
+		RR:       tea.String(r.RR),
+		Type:     tea.String(r.Type),
+		Value:    tea.String(r.Value),
+	}
+	if r.TTL > 0 {
+		req.TTL = tea.Int64(r.TTL)
+	}
+	if r.Priority > 0 {
+		req.Priority = tea.Int64(r.Priority)
+	}
+	if r.Line != "" {
+		req.Line = tea.String(r.Line)
+	}
+	return p.do(ctx, "UpdateDomainRecord", func(runtime *util.RuntimeOptions) error {
+		_, err := p.client.UpdateDomainRecordWithOptions(req, runtime)
+		return err
+	})
+}
+
+func (p *Aliyun) DeleteRecord(ctx context.Context, recordId string) error {
+	req := &alidns20150109.DeleteDomainRecordRequest{
+		RecordId: tea.String(recordId),
+	}
+	return p.do(ctx, "DeleteDomainRecord", func(runtime *util.RuntimeOptions) error {
+		_, err := p.client.DeleteDomainRecordWithOptions(req, runtime)
+		return err
+	})
+}
+
+func (p *Aliyun) EnableRecord(ctx context.Context, recordId string) error {
+	return p.setStatus(ctx, recordId, "ENABLE")
+}
+
+func (p *Aliyun) DisableRecord(ctx context.Context, recordId string) error {
+	return p.setStatus(ctx, recordId, "DISABLE")
+}
+
+func (p *Aliyun) setStatus(ctx context.Context, recordId, status string) error {
+	req := &alidns20150109.SetDomainRecordStatusRequest{
+		RecordId: tea.String(recordId),
+		Status:   tea.String(status),
+	}
+	return p.do(ctx, "SetDomainRecordStatus", func(runtime *util.RuntimeOptions) error {
+		_, err := p.client.SetDomainRecordStatusWithOptions(req, runtime)
+		return err
+	})
+}
+
+// do runs an idempotent API call under the retry policy. The SDK is not
+// context aware, so each attempt's deadline is turned into read and connect
+// timeouts.
+func (p *Aliyun) do(ctx context.Context, op string, call func(runtime *util.RuntimeOptions) error) error {
+	return retry.Do(ctx, p.Retry, op, aliyun.Retryable, func(ctx context.Context) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		return call(aliyun.RuntimeOptions(ctx, 0))
+	})
+}
@@ -0,0 +1,135 @@
+package dns
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+
+	alidns20150109 "github.com/alibabacloud-go/alidns-20150109/v5/client"
+
+	"auto-https/internal/aliyun"
+	"auto-https/internal/retry"
+)
+
+// fakeRecords serves DescribeDomainRecords in pages, filtering by RRKeyWord
+// and TypeKeyWord the way the service does, and counts the requested pages.
+func fakeRecords(t *testing.T, records []Record) (*httptest.Server, *[]int) {
+	var pages []int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			t.Errorf("parse form: %v", err)
+		}
+		if action := r.Header.Get("x-acs-action"); action != "DescribeDomainRecords" {
+			t.Errorf("unexpected action %q", action)
+			http.NotFound(w, r)
+			return
+		}
+		page, _ := strconv.Atoi(r.Form.Get("PageNumber"))
+		size, _ := strconv.Atoi(r.Form.Get("PageSize"))
+		pages = append(pages, page)
+		var match []map[string]any
+		for _, rec := range records {
+			if kw := r.Form.Get("RRKeyWord"); kw != "" && !strings.Contains(rec.RR, kw) {
+				continue
+			}
+			if kw := r.Form.Get("TypeKeyWord"); kw != "" && rec.Type != kw {
+				continue
+			}
+			match = append(match, map[string]any{
+				"RecordId": rec.ID, "RR": rec.RR, "Type": rec.Type, "Value": rec.Value,
+				"TTL": 600, "Line": "default", "Status": "ENABLE",
+			})
+		}
+		total := len(match)
+		start, end := (page-1)*size, page*size
+		if start > total {
+			start = total
+		}
+		if end > total {
+			end = total
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]any{
+			"RequestId":     "fake",
+			"TotalCount":    total,
+			"PageNumber":    page,
+			"PageSize":      size,
+			"DomainRecords": map[string]any{"Record": match[start:end]},
+		})
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &pages
+}
+
+func newFakeAliyun(t *testing.T, url string, pageSize int64) *Aliyun {
+	client, err := alidns20150109.NewClient(aliyun.Config("ak", "secret", url))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &Aliyun{client: client, PageSize: pageSize, Retry: retry.Policy{Attempts: 1}}
+}
+
+var pagedRecords = []Record{
+	{ID: "1", RR: "www1", Type: "A", Value: "192.0.2.1"},
+	{ID: "2", RR: "www2", Type: "A", Value: "192.0.2.2"},
+	{ID: "3", RR: "mail", Type: "MX", Value: "mx.example.com"},
+	{ID: "4", RR: "www3", Type: "A", Value: "192.0.2.3"},
+	{ID: "5", RR: "www", Type: "CNAME", Value: "cdn.example.net"},
+	{ID: "6", RR: "www", Type: "A", Value: "192.0.2.4"},
+}
+
+func TestAliyunListRecordsPages(t *testing.T) {
+	srv, pages := fakeRecords(t, pagedRecords)
+	p := newFakeAliyun(t, srv.URL, 2)
+
+	got, err := p.ListRecords(context.Background(), "example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != len(pagedRecords) {
+		t.Fatalf("got %d records, want %d", len(got), len(pagedRecords))
+	}
+	for i, r := range got {
+		if r.ID != pagedRecords[i].ID || r.RR != pagedRecords[i].RR {
+			t.Errorf("record %d = %s %s, want %s %s", i, r.ID, r.RR, pagedRecords[i].ID, pagedRecords[i].RR)
+		}
+	}
+	if want := []int{1, 2, 3}; !slices.Equal(*pages, want) {
+		t.Errorf("requested pages %v, want %v", *pages, want)
+	}
+}
+
+func TestAliyunFindRecordOnLaterPage(t *testing.T) {
+	srv, pages := fakeRecords(t, pagedRecords)
+	p := newFakeAliyun(t, srv.URL, 2)
+
+	// the keyword matches www1..www3 first, the exact record is on page 2
+	r, err := p.FindRecord(context.Background(), "example.com", "www", "A", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r == nil || r.ID != "6" {
+		t.Fatalf("FindRecord = %+v, want record 6", r)
+	}
+	if len(*pages) < 2 {
+		t.Errorf("requested pages %v, want more than one", *pages)
+	}
+
+	r, err = p.FindRecord(context.Background(), "example.com", "www", "", "cdn.example.net")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r == nil || r.ID != "5" {
+		t.Fatalf("FindRecord by value = %+v, want record 5", r)
+	}
+
+	r, err = p.FindRecord(context.Background(), "example.com", "ftp", "", "")
+	if err != nil || r != nil {
+		t.Fatalf("FindRecord(ftp) = %+v, %v; want nil, nil", r, err)
+	}
+}
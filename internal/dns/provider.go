@@ -0,0 +1,47 @@
+package dns
+
+import (
+	"context"
+	"strings"
+)
+
+type Record struct {
+	ID       string
+	RR       string
+	Type     string
+	Value    string
+	TTL      int64
+	Priority int64
+	Line     string
+	Status   string
+}
+
+// Provider is the set of DNS operations used by alidns-update and rotate-cert.
+type Provider interface {
+	ListRecords(ctx context.Context, domain string) ([]Record, error)
+	FindRecord(ctx context.Context, domain, rr, typ, value string) (*Record, error)
+	AddRecord(ctx context.Context, domain string, r Record) (string, error)
+	UpdateRecord(ctx context.Context, r Record) error
+	DeleteRecord(ctx context.Context, recordId string) error
+	EnableRecord(ctx context.Context, recordId string) error
+	DisableRecord(ctx context.Context, recordId string) error
+}
+
+// MatchRecord returns the first record with the exact rr; typ and value are
+// only compared when non-empty.
+func MatchRecord(records []Record, rr, typ, value string) *Record {
+	for i := range records {
+		r := &records[i]
+		if !strings.EqualFold(r.RR, rr) {
+			continue
+		}
+		if typ != "" && !strings.EqualFold(r.Type, typ) {
+			continue
+		}
+		if value != "" && !strings.EqualFold(r.Value, value) {
+			continue
+		}
+		return r
+	}
+	return nil
+}
@@ -0,0 +1,94 @@
+package dns
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// Swap disables one record and enables another, remembering the original
+// statuses so Restore can put them back whatever happens in between.
+type Swap struct {
+	Provider Provider
+	Disable  Record
+	Enable   Record
+
+	// mu is held across provider calls so Restore never runs while a change
+	// is in flight and then gets undone by it
+	mu       sync.Mutex
+	touched  []touchedRecord
+	restored bool
+	err      error
+}
+
+type touchedRecord struct {
+	Record
+	wasEnabled bool
+}
+
+// Apply performs the swap. If either step fails, everything touched is
+// restored before returning the error: a step that timed out may still have
+// been applied by the server.
+func (s *Swap) Apply(ctx context.Context) error {
+	err := s.set(ctx, s.Disable, false)
+	if err != nil {
+		err = fmt.Errorf("disable %s: %w", s.Disable.RR, err)
+	} else if err = s.set(ctx, s.Enable, true); err != nil {
+		err = fmt.Errorf("enable %s: %w", s.Enable.RR, err)
+	}
+	if err == nil {
+		return nil
+	}
+	if rerr := s.Restore(ctx); rerr != nil {
+		return errors.Join(err, rerr)
+	}
+	return err
+}
+
+func (s *Swap) set(ctx context.Context, r Record, enable bool) error {
+	// without a known status assume the record was in the opposite state
+	wasEnabled := !enable
+	if r.Status != "" {
+		wasEnabled = !strings.EqualFold(r.Status, "DISABLE")
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.restored {
+		// restored concurrently, e.g. on a signal; do not undo that
+		return errors.New("swap already restored")
+	}
+	s.touched = append(s.touched, touchedRecord{Record: r, wasEnabled: wasEnabled})
+	if enable {
+		return s.Provider.EnableRecord(ctx, r.ID)
+	}
+	return s.Provider.DisableRecord(ctx, r.ID)
+}
+
+// Restore returns every touched record to its original status. It is safe to
+// call more than once and from several goroutines; only the first call acts.
+// A change still in flight is waited for first.
+func (s *Swap) Restore(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.restored {
+		return s.err
+	}
+	s.restored = true
+	var errs []error
+	for i := len(s.touched) - 1; i >= 0; i-- {
+		r := s.touched[i]
+		var err error
+		if r.wasEnabled {
+			err = s.Provider.EnableRecord(ctx, r.ID)
+		} else {
+			err = s.Provider.DisableRecord(ctx, r.ID)
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("restore %s: %w", r.RR, err))
+		}
+	}
+	s.err = errors.Join(errs...)
+	return s.err
+}
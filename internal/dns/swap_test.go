@@ -0,0 +1,102 @@
+package dns
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// statusProvider tracks record statuses; fail makes the next change of the
+// named record return an error after applying it, as a timed out call would.
+type statusProvider struct {
+	Provider
+	enabled map[string]bool
+	fail    map[string]bool
+	before  func(id string)
+}
+
+func (p *statusProvider) EnableRecord(ctx context.Context, id string) error {
+	return p.setStatus(id, true)
+}
+
+func (p *statusProvider) DisableRecord(ctx context.Context, id string) error {
+	return p.setStatus(id, false)
+}
+
+func (p *statusProvider) setStatus(id string, enabled bool) error {
+	if p.before != nil {
+		p.before(id)
+	}
+	p.enabled[id] = enabled
+	if p.fail[id] {
+		delete(p.fail, id)
+		return errors.New("timeout")
+	}
+	return nil
+}
+
+func newSwap(p *statusProvider) *Swap {
+	return &Swap{
+		Provider: p,
+		Disable:  Record{ID: "a", RR: "a", Status: "ENABLE"},
+		Enable:   Record{ID: "b", RR: "b", Status: "DISABLE"},
+	}
+}
+
+func TestSwapApplyAndRestore(t *testing.T) {
+	p := &statusProvider{enabled: map[string]bool{"a": true, "b": false}}
+	s := newSwap(p)
+	if err := s.Apply(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if p.enabled["a"] || !p.enabled["b"] {
+		t.Fatalf("after Apply: %v", p.enabled)
+	}
+	if err := s.Restore(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if !p.enabled["a"] || p.enabled["b"] {
+		t.Fatalf("after Restore: %v", p.enabled)
+	}
+}
+
+func TestSwapApplyRestoresOnFailure(t *testing.T) {
+	for _, failing := range []string{"a", "b"} {
+		p := &statusProvider{enabled: map[string]bool{"a": true, "b": false}, fail: map[string]bool{failing: true}}
+		if err := newSwap(p).Apply(context.Background()); err == nil {
+			t.Fatalf("failing %s: Apply succeeded", failing)
+		}
+		if !p.enabled["a"] || p.enabled["b"] {
+			t.Errorf("failing %s: not restored: %v", failing, p.enabled)
+		}
+	}
+}
+
+func TestSwapRestoredDuringApply(t *testing.T) {
+	p := &statusProvider{enabled: map[string]bool{"a": true, "b": false}}
+	s := newSwap(p)
+	// a signal handler restores while a is being disabled; give it time to
+	// finish before the disable lands, as it would if it did not wait
+	finished := make(chan struct{})
+	var restoreErr error
+	p.before = func(id string) {
+		p.before = nil
+		go func() {
+			restoreErr = s.Restore(context.Background())
+			close(finished)
+		}()
+		select {
+		case <-finished:
+		case <-time.After(50 * time.Millisecond):
+		}
+	}
+	s.Apply(context.Background())
+	<-finished
+	if restoreErr != nil {
+		t.Fatal(restoreErr)
+	}
+	if !p.enabled["a"] || p.enabled["b"] {
+		t.Errorf("not restored: %v", p.enabled)
+	}
+}
@@ -0,0 +1,173 @@
+package qiniu
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/qiniu/go-sdk/v7/auth/qbox"
+
+	"auto-https/internal/retry"
+)
+
+const DefaultAPIHost = "https://api.qiniu.com"
+
+const (
+	TokenAuto = "auto"
+	TokenV1   = "v1"
+	TokenV2   = "v2"
+)
+
+// Client talks to the Qiniu CDN/SSL management API.
+type Client struct {
+	AccessKey string
+	SecretKey string
+	// BaseURL defaults to DefaultAPIHost.
+	BaseURL string
+	// TokenMode selects the QBox (v1) or Qiniu (v2) signature; auto tries both.
+	TokenMode  string
+	HTTPClient *http.Client
+	// Retry applies to GET, PUT and DELETE requests; POST uploads are sent
+	// once so a lost answer cannot create a duplicate certificate.
+	Retry retry.Policy
+}
+
+func New(accessKey, secretKey string) *Client {
+	return &Client{
+		AccessKey:  accessKey,
+		SecretKey:  secretKey,
+		BaseURL:    DefaultAPIHost,
+		TokenMode:  TokenAuto,
+		HTTPClient: &http.Client{},
+		Retry:      retry.Default,
+	}
+}
+
+// Error is a non-2xx answer from the API.
+type Error struct {
+	StatusCode int    `json:"-"`
+	Code       int    `json:"code"`
+	Message    string `json:"error"`
+}
+
+func (e *Error) Error() string {
+	if e.Code != 0 {
+		return fmt.Sprintf("qiniu: http %d, code %d: %s", e.StatusCode, e.Code, e.Message)
+	}
+	return fmt.Sprintf("qiniu: http %d: %s", e.StatusCode, e.Message)
+}
+
+// Retryable reports answers worth another attempt: server errors, 429 and
+// Qiniu's 573 rate limit.
+func Retryable(err error) bool {
+	var apiErr *Error
+	if !errors.As(err, &apiErr) {
+		return false
+	}
+	return apiErr.StatusCode >= 500 || apiErr.StatusCode == http.StatusTooManyRequests
+}
+
+func (c *Client) tokens(method, rawURL string, body []byte) []string {
+	req, _ := http.NewRequest(method, rawURL, bytes.NewReader(body))
+	if len(body) > 0 {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	mac := qbox.NewMac(c.AccessKey, c.SecretKey)
+	var tokens []string
+	if c.TokenMode != TokenV2 {
+		if tk, err := mac.SignRequest(req); err == nil {
+			tokens = append(tokens, "QBox "+tk)
+		}
+	}
+	if c.TokenMode != TokenV1 {
+		if tk, err := mac.SignRequestV2(req); err == nil {
+			tokens = append(tokens, "Qiniu "+tk)
+		}
+	}
+	return tokens
+}
+
+// do sends in as JSON (when non-nil) and decodes the answer into out (when
+// non-nil). With TokenAuto a request rejected with 401 is retried with the
+// next signature scheme. Requests other than POST follow c.Retry.
+func (c *Client) do(ctx context.Context, method, path string, in, out any) error {
+	op := method + " " + path
+	if method == http.MethodPost {
+		p := c.Retry
+		p.Attempts = 1
+		return retry.Do(ctx, p, op, Retryable, func(ctx context.Context) error {
+			return c.send(ctx, method, path, in, out)
+		})
+	}
+	return retry.Do(ctx, c.Retry, op, Retryable, func(ctx context.Context) error {
+		return c.send(ctx, method, path, in, out)
+	})
+}
+
+func (c *Client) send(ctx context.Context, method, path string, in, out any) error {
+	var body []byte
+	if in != nil {
+		b, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = b
+	}
+	base := c.BaseURL
+	if base == "" {
+		base = DefaultAPIHost
+	}
+	rawURL := strings.TrimSuffix(base, "/") + path
+	hc := c.HTTPClient
+	if hc == nil {
+		hc = http.DefaultClient
+	}
+
+	var lastErr error
+	for _, tk := range c.tokens(method, rawURL, body) {
+		req, err := http.NewRequestWithContext(ctx, method, rawURL, bytes.NewReader(body))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Authorization", tk)
+		if body != nil {
+			req.Header.Set("Content-Type", "application/json")
+		}
+		resp, err := hc.Do(req)
+		if err != nil {
+			return err
+		}
+		rb, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return err
+		}
+		if resp.StatusCode/100 != 2 {
+			apiErr := &Error{StatusCode: resp.StatusCode}
+			if json.Unmarshal(rb, apiErr) != nil || apiErr.Message == "" {
+				apiErr.Message = strings.TrimSpace(string(rb))
+			}
+			lastErr = apiErr
+			if resp.StatusCode == http.StatusUnauthorized {
+				continue
+			}
+			return apiErr
+		}
+		if out == nil || len(rb) == 0 {
+			return nil
+		}
+		if err := json.Unmarshal(rb, out); err != nil {
+			return fmt.Errorf("qiniu: decode %s %s: %w", method, path, err)
+		}
+		return nil
+	}
+	if lastErr == nil {
+		lastErr = fmt.Errorf("qiniu: no usable token for mode %q", c.TokenMode)
+	}
+	return lastErr
+}
@@ -0,0 +1,102 @@
+package qiniu
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"time"
+)
+
+// Domain is the subset of GET /domain/{name} used here.
+type Domain struct {
+	Name               string    `json:"name"`
+	Type               string    `json:"type"`
+	CName              string    `json:"cname"`
+	Protocol           string    `json:"protocol"`
+	OperatingState     string    `json:"operatingState"`
+	OperatingStateDesc string    `json:"operatingStateDesc"`
+	HTTPS              HTTPSConf `json:"https"`
+}
+
+type listDomainsResponse struct {
+	Marker  string   `json:"marker"`
+	Domains []Domain `json:"domains"`
+}
+
+// ListDomains returns every CDN domain in the account. The listing does not
+// carry HTTPS settings; use GetDomain for those.
+func (c *Client) ListDomains(ctx context.Context) ([]Domain, error) {
+	var all []Domain
+	marker := ""
+	for {
+		q := url.Values{"limit": {"1000"}}
+		if marker != "" {
+			q.Set("marker", marker)
+		}
+		var resp listDomainsResponse
+		if err := c.do(ctx, "GET", "/domain?"+q.Encode(), nil, &resp); err != nil {
+			return nil, err
+		}
+		all = append(all, resp.Domains...)
+		if resp.Marker == "" || resp.Marker == marker || len(resp.Domains) == 0 {
+			return all, nil
+		}
+		marker = resp.Marker
+	}
+}
+
+func (c *Client) GetDomain(ctx context.Context, name string) (*Domain, error) {
+	d := &Domain{}
+	if err := c.do(ctx, "GET", "/domain/"+url.PathEscape(name), nil, d); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// BoundDomains maps certID to the CDN domains currently serving it.
+func (c *Client) BoundDomains(ctx context.Context) (map[string][]string, error) {
+	domains, err := c.ListDomains(ctx)
+	if err != nil {
+		return nil, err
+	}
+	bound := map[string][]string{}
+	for _, d := range domains {
+		detail, err := c.GetDomain(ctx, d.Name)
+		if err != nil {
+			return nil, err
+		}
+		if id := detail.HTTPS.CertID; id != "" {
+			bound[id] = append(bound[id], d.Name)
+		}
+	}
+	return bound, nil
+}
+
+// Domain operating states reported by Qiniu.
+const (
+	StateSuccess    = "success"
+	StateProcessing = "processing"
+	StateFailed     = "failed"
+)
+
+// WaitDomainReady polls the domain until its last configuration change has
+// been applied (operatingState success) or failed.
+func (c *Client) WaitDomainReady(ctx context.Context, name string, interval time.Duration) error {
+	for {
+		d, err := c.GetDomain(ctx, name)
+		if err != nil {
+			return err
+		}
+		switch d.OperatingState {
+		case StateSuccess:
+			return nil
+		case StateFailed:
+			return fmt.Errorf("qiniu: domain %s change failed: %s", name, d.OperatingStateDesc)
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("qiniu: domain %s still %s: %w", name, d.OperatingState, ctx.Err())
+		case <-time.After(interval):
+		}
+	}
+}
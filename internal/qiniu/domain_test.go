@@ -0,0 +1,55 @@
+package qiniu
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+// domainStates answers GET /domain/{name} with the given operating states in
+// turn, repeating the last one.
+func domainStates(states ...string) http.HandlerFunc {
+	n := 0
+	return func(w http.ResponseWriter, r *http.Request) {
+		state := states[min(n, len(states)-1)]
+		n++
+		d := Domain{Name: strings.TrimPrefix(r.URL.Path, "/domain/"), OperatingState: state}
+		if state == StateFailed {
+			d.OperatingStateDesc = "certificate does not match domain"
+		}
+		json.NewEncoder(w).Encode(d)
+	}
+}
+
+func TestWaitDomainReadySuccess(t *testing.T) {
+	c := newTestClient(t, domainStates(StateProcessing, StateProcessing, StateSuccess))
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := c.WaitDomainReady(ctx, "cdn.example.com", 10*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestWaitDomainReadyFailed(t *testing.T) {
+	c := newTestClient(t, domainStates(StateProcessing, StateFailed))
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	err := c.WaitDomainReady(ctx, "cdn.example.com", 10*time.Millisecond)
+	if err == nil || !strings.Contains(err.Error(), "certificate does not match domain") {
+		t.Fatalf("error = %v", err)
+	}
+}
+
+func TestWaitDomainReadyTimeout(t *testing.T) {
+	c := newTestClient(t, domainStates(StateProcessing))
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	err := c.WaitDomainReady(ctx, "cdn.example.com", 10*time.Millisecond)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("error = %v", err)
+	}
+}
@@ -0,0 +1,42 @@
+package qiniu
+
+import (
+	"sort"
+	"strings"
+)
+
+// Superseded picks certificates that may be deleted: for each common name the
+// keep newest (by NotAfter, then CreateTime) are retained, and a certificate
+// bound to any domain is never returned.
+func Superseded(certs []Cert, bound map[string][]string, keep int) []Cert {
+	if keep < 1 {
+		keep = 1
+	}
+	byCN := map[string][]Cert{}
+	for _, c := range certs {
+		cn := strings.ToLower(c.CommonName)
+		byCN[cn] = append(byCN[cn], c)
+	}
+	var out []Cert
+	for _, group := range byCN {
+		sort.Slice(group, func(i, j int) bool {
+			if group[i].NotAfter != group[j].NotAfter {
+				return group[i].NotAfter > group[j].NotAfter
+			}
+			return group[i].CreateTime > group[j].CreateTime
+		})
+		for i, c := range group {
+			if i < keep || len(bound[c.CertID]) > 0 {
+				continue
+			}
+			out = append(out, c)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].CommonName != out[j].CommonName {
+			return out[i].CommonName < out[j].CommonName
+		}
+		return out[i].NotAfter > out[j].NotAfter
+	})
+	return out
+}
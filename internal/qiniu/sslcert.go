@@ -0,0 +1,106 @@
+package qiniu
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+)
+
+// UploadCertRequest is the body of POST /sslcert.
+type UploadCertRequest struct {
+	Name       string `json:"name"`
+	CommonName string `json:"common_name"`
+	Pri        string `json:"pri"`
+	CA         string `json:"ca"`
+}
+
+type uploadCertResponse struct {
+	CertID string `json:"certID"`
+}
+
+// UploadCert stores a certificate and returns its certID.
+func (c *Client) UploadCert(ctx context.Context, req UploadCertRequest) (string, error) {
+	var resp uploadCertResponse
+	if err := c.do(ctx, "POST", "/sslcert", req, &resp); err != nil {
+		return "", err
+	}
+	if resp.CertID == "" {
+		return "", fmt.Errorf("qiniu: no certID in upload response")
+	}
+	return resp.CertID, nil
+}
+
+// HTTPSConf is the body of PUT /domain/{name}/httpsconf.
+type HTTPSConf struct {
+	CertID      string `json:"certId"`
+	ForceHTTPS  bool   `json:"forceHttps"`
+	HTTP2Enable bool   `json:"http2Enable"`
+}
+
+// UpdateHTTPSConf changes the certificate and HTTPS switches of a CDN domain.
+func (c *Client) UpdateHTTPSConf(ctx context.Context, domain string, conf HTTPSConf) error {
+	return c.do(ctx, "PUT", "/domain/"+url.PathEscape(domain)+"/httpsconf", conf, nil)
+}
+
+// Cert is one entry of GET /sslcert. Times are unix seconds.
+type Cert struct {
+	CertID     string   `json:"certid"`
+	Name       string   `json:"name"`
+	CommonName string   `json:"common_name"`
+	DNSNames   []string `json:"dnsnames"`
+	NotBefore  int64    `json:"not_before"`
+	NotAfter   int64    `json:"not_after"`
+	CreateTime int64    `json:"create_time"`
+}
+
+type listCertsResponse struct {
+	Marker string `json:"marker"`
+	Certs  []Cert `json:"certs"`
+}
+
+// ListCerts returns every certificate in the account.
+func (c *Client) ListCerts(ctx context.Context) ([]Cert, error) {
+	var all []Cert
+	marker := ""
+	for {
+		q := url.Values{"limit": {"100"}}
+		if marker != "" {
+			q.Set("marker", marker)
+		}
+		var resp listCertsResponse
+		if err := c.do(ctx, "GET", "/sslcert?"+q.Encode(), nil, &resp); err != nil {
+			return nil, err
+		}
+		all = append(all, resp.Certs...)
+		if resp.Marker == "" || resp.Marker == marker || len(resp.Certs) == 0 {
+			return all, nil
+		}
+		marker = resp.Marker
+	}
+}
+
+// DeleteCert removes a certificate; Qiniu refuses to delete a bound one.
+func (c *Client) DeleteCert(ctx context.Context, certID string) error {
+	return c.do(ctx, "DELETE", "/sslcert/"+url.PathEscape(certID), nil, nil)
+}
+
+// CertDetail is GET /sslcert/{id}; CA holds the certificate chain PEM.
+type CertDetail struct {
+	Cert
+	CA string `json:"ca"`
+}
+
+type getCertResponse struct {
+	Cert CertDetail `json:"cert"`
+}
+
+func (c *Client) GetCert(ctx context.Context, certID string) (*CertDetail, error) {
+	var resp getCertResponse
+	if err := c.do(ctx, "GET", "/sslcert/"+url.PathEscape(certID), nil, &resp); err != nil {
+		return nil, err
+	}
+	if resp.Cert.CertID == "" {
+		resp.Cert.CertID = certID
+	}
+	return &resp.Cert, nil
+}
@@ -0,0 +1,82 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"net"
+	"time"
+)
+
+// Policy controls how an idempotent remote call is retried.
+type Policy struct {
+	// Attempts is the total number of tries; values below 1 mean one try.
+	Attempts int
+	// Base is the first backoff; it doubles each attempt up to Max and a
+	// random jitter of up to the same amount is added.
+	Base time.Duration
+	Max  time.Duration
+	// Timeout bounds each attempt; zero leaves only the caller's deadline.
+	Timeout time.Duration
+	// OnRetry, if set, is called before waiting for the next attempt.
+	OnRetry func(op string, attempt int, err error, wait time.Duration)
+}
+
+var Default = Policy{Attempts: 4, Base: time.Second, Max: 30 * time.Second, Timeout: 30 * time.Second}
+
+// Backoff is the wait before attempt n+1 (n starts at 1).
+func (p Policy) Backoff(n int) time.Duration {
+	base := p.Base
+	if base <= 0 {
+		base = time.Second
+	}
+	d := base << (n - 1)
+	if d <= 0 || (p.Max > 0 && d > p.Max) {
+		d = p.Max
+	}
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
+
+// Do calls fn until it succeeds, retryable reports false, the attempts are
+// used up or ctx ends. The last error is returned.
+func Do(ctx context.Context, p Policy, op string, retryable func(error) bool, fn func(ctx context.Context) error) error {
+	attempts := p.Attempts
+	if attempts < 1 {
+		attempts = 1
+	}
+	var err error
+	for n := 1; ; n++ {
+		err = attempt(ctx, p.Timeout, fn)
+		if err == nil || n >= attempts || ctx.Err() != nil || !(Temporary(err) || retryable(err)) {
+			return err
+		}
+		wait := p.Backoff(n)
+		if p.OnRetry != nil {
+			p.OnRetry(op, n, err, wait)
+		}
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(wait):
+		}
+	}
+}
+
+func attempt(ctx context.Context, timeout time.Duration, fn func(ctx context.Context) error) error {
+	if timeout <= 0 {
+		return fn(ctx)
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	return fn(ctx)
+}
+
+// Temporary reports network level failures that are always worth retrying.
+func Temporary(err error) bool {
+	var ne net.Error
+	if errors.As(err, &ne) && ne.Timeout() {
+		return true
+	}
+	var oe *net.OpError
+	return errors.As(err, &oe) || errors.Is(err, context.DeadlineExceeded)
+}
@@ -0,0 +1,189 @@
+package state
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// SchemaVersion is written to every state file. Files without a version are
+// the legacy {"last_replace_unix": N} format and are migrated on load.
+const SchemaVersion = 1
+
+// MaxHistory is the number of runs kept per job.
+const MaxHistory = 50
+
+// LegacyJob holds the timestamp migrated from a version 0 file, which was
+// written by a single job; Last falls back to it for jobs without history.
+const LegacyJob = "_legacy"
+
+const (
+	OutcomeSuccess = "success"
+	OutcomeFailed  = "failed"
+	OutcomeSkipped = "skipped"
+)
+
+type File struct {
+	Version int             `json:"version"`
+	Jobs    map[string]*Job `json:"jobs"`
+	// LastReplaceUnix is only read from legacy files.
+	LastReplaceUnix int64 `json:"last_replace_unix,omitempty"`
+}
+
+type Job struct {
+	Runs []Run `json:"runs"`
+}
+
+// Run is one execution of a job.
+type Run struct {
+	Start        time.Time  `json:"start"`
+	End          time.Time  `json:"end"`
+	Outcome      string     `json:"outcome"`
+	Error        string     `json:"error,omitempty"`
+	CertSerial   string     `json:"cert_serial,omitempty"`
+	CertNotAfter *time.Time `json:"cert_not_after,omitempty"`
+	QiniuCertID  string     `json:"qiniu_cert_id,omitempty"`
+	CASCertID    string     `json:"cas_cert_id,omitempty"`
+	DNSActions   []string   `json:"dns_actions,omitempty"`
+}
+
+// Store is a JSON state file. Every write replaces the file atomically.
+type Store struct {
+	path string
+	mu   sync.Mutex
+}
+
+var stores sync.Map
+
+// Open returns the store for path; the same *Store is shared by all callers
+// using that path so writes from several jobs do not interleave.
+func Open(path string) *Store {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		abs = path
+	}
+	s, _ := stores.LoadOrStore(abs, &Store{path: path})
+	return s.(*Store)
+}
+
+// Load reads the file; a missing file yields an empty state.
+func (s *Store) Load() (*File, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.load()
+}
+
+func (s *Store) load() (*File, error) {
+	b, err := os.ReadFile(s.path)
+	if os.IsNotExist(err) {
+		return &File{Version: SchemaVersion, Jobs: map[string]*Job{}}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	f := &File{}
+	if err := json.Unmarshal(b, f); err != nil {
+		return nil, fmt.Errorf("%s: %w", s.path, err)
+	}
+	if f.Version > SchemaVersion {
+		return nil, fmt.Errorf("%s: schema version %d is newer than supported %d", s.path, f.Version, SchemaVersion)
+	}
+	if f.Jobs == nil {
+		f.Jobs = map[string]*Job{}
+	}
+	if f.Version == 0 {
+		if f.LastReplaceUnix > 0 {
+			t := time.Unix(f.LastReplaceUnix, 0)
+			f.Jobs[LegacyJob] = &Job{Runs: []Run{{Start: t, End: t, Outcome: OutcomeSuccess}}}
+		}
+		f.LastReplaceUnix = 0
+		f.Version = SchemaVersion
+	}
+	return f, nil
+}
+
+// Record appends run to the history of job and saves the file.
+func (s *Store) Record(job string, run Run) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	f, err := s.load()
+	if err != nil {
+		return err
+	}
+	j := f.Jobs[job]
+	if j == nil {
+		j = &Job{}
+		f.Jobs[job] = j
+	}
+	j.Runs = append(j.Runs, run)
+	if len(j.Runs) > MaxHistory {
+		j.Runs = j.Runs[len(j.Runs)-MaxHistory:]
+	}
+	return s.save(f)
+}
+
+// Last returns the most recent run of job, or of LegacyJob when job has none
+// yet, or nil.
+func (s *Store) Last(job string) (*Run, error) {
+	f, err := s.Load()
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range []string{job, LegacyJob} {
+		if j := f.Jobs[name]; j != nil && len(j.Runs) > 0 {
+			return &j.Runs[len(j.Runs)-1], nil
+		}
+	}
+	return nil, nil
+}
+
+// LastSuccess returns the most recent successful run of job, or nil.
+func (s *Store) LastSuccess(job string) (*Run, error) {
+	f, err := s.Load()
+	if err != nil {
+		return nil, err
+	}
+	if j := f.Jobs[job]; j != nil {
+		for i := len(j.Runs) - 1; i >= 0; i-- {
+			if j.Runs[i].Outcome == OutcomeSuccess {
+				return &j.Runs[i], nil
+			}
+		}
+	}
+	return nil, nil
+}
+
+func (s *Store) save(f *File) error {
+	b, err := json.MarshalIndent(f, "", "  ")
+	if err != nil {
+		return err
+	}
+	b = append(b, '\n')
+	dir := filepath.Dir(s.path)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(dir, filepath.Base(s.path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), s.path)
+}
@@ -0,0 +1,103 @@
+package state
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLegacyMigration(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	if err := os.WriteFile(path, []byte(`{"last_replace_unix": 1700000000}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	s := Open(path)
+	last, err := s.Last("web")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if last == nil || !last.End.Equal(time.Unix(1700000000, 0)) {
+		t.Fatalf("Last before any run = %+v, want the legacy timestamp", last)
+	}
+
+	run := Run{Start: time.Unix(1800000000, 0), End: time.Unix(1800000060, 0), Outcome: OutcomeFailed, Error: "boom"}
+	if err := s.Record("web", run); err != nil {
+		t.Fatal(err)
+	}
+	last, err = s.Last("web")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if last == nil || last.Outcome != OutcomeFailed || last.Error != "boom" {
+		t.Fatalf("Last = %+v", last)
+	}
+
+	f, err := s.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.Version != SchemaVersion || f.LastReplaceUnix != 0 || f.Jobs[LegacyJob] == nil {
+		t.Errorf("saved file = %+v", f)
+	}
+}
+
+func TestRecordKeepsHistory(t *testing.T) {
+	s := Open(filepath.Join(t.TempDir(), "sub", "state.json"))
+	if last, err := s.Last("web"); err != nil || last != nil {
+		t.Fatalf("Last on a missing file = %+v, %v", last, err)
+	}
+	for i := 0; i < MaxHistory+5; i++ {
+		if err := s.Record("web", Run{Start: time.Unix(int64(i), 0), Outcome: OutcomeSuccess}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.Record("cdn", Run{Outcome: OutcomeSkipped}); err != nil {
+		t.Fatal(err)
+	}
+	f, err := s.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	runs := f.Jobs["web"].Runs
+	if len(runs) != MaxHistory || runs[0].Start.Unix() != 5 {
+		t.Errorf("kept %d runs starting at %d", len(runs), runs[0].Start.Unix())
+	}
+	if len(f.Jobs["cdn"].Runs) != 1 {
+		t.Errorf("cdn runs = %+v", f.Jobs["cdn"].Runs)
+	}
+}
+
+func TestNewerSchemaRejected(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	if err := os.WriteFile(path, []byte(`{"version": 99, "jobs": {}}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Open(path).Load(); err == nil {
+		t.Error("loaded a file with a newer schema")
+	}
+}
+
+func TestLastSuccess(t *testing.T) {
+	s := Open(filepath.Join(t.TempDir(), "state.json"))
+	if last, err := s.LastSuccess("web"); err != nil || last != nil {
+		t.Fatalf("LastSuccess without runs = %+v, %v", last, err)
+	}
+	for _, r := range []Run{
+		{Outcome: OutcomeSuccess, CertSerial: "01"},
+		{Outcome: OutcomeSuccess, CertSerial: "02"},
+		{Outcome: OutcomeFailed, CertSerial: "03"},
+		{Outcome: OutcomeSkipped, CertSerial: "02"},
+	} {
+		if err := s.Record("web", r); err != nil {
+			t.Fatal(err)
+		}
+	}
+	last, err := s.LastSuccess("web")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if last == nil || last.CertSerial != "02" {
+		t.Fatalf("LastSuccess = %+v, want serial 02", last)
+	}
+}
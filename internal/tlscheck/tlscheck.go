@@ -0,0 +1,88 @@
+package tlscheck
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+)
+
+// Fetch performs a TLS handshake with addr (host:port) using serverName as
+// SNI and returns the presented chain. The chain is not verified: callers
+// compare it against the certificate they expect.
+func Fetch(ctx context.Context, addr, serverName string) ([]*x509.Certificate, error) {
+	d := &tls.Dialer{
+		NetDialer: &net.Dialer{Timeout: 10 * time.Second},
+		Config:    &tls.Config{ServerName: serverName, InsecureSkipVerify: true},
+	}
+	conn, err := d.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	chain := conn.(*tls.Conn).ConnectionState().PeerCertificates
+	if len(chain) == 0 {
+		return nil, errors.New("no certificate presented")
+	}
+	return chain, nil
+}
+
+// Expect checks once that addr presents a leaf with the given SHA-256 fingerprint.
+func Expect(ctx context.Context, addr, serverName, fingerprint string) error {
+	chain, err := Fetch(ctx, addr, serverName)
+	if err != nil {
+		return err
+	}
+	sum := sha256.Sum256(chain[0].Raw)
+	if got := hex.EncodeToString(sum[:]); got != fingerprint {
+		return fmt.Errorf("%s (%s) serves serial %s, fingerprint %s", addr, serverName, chain[0].SerialNumber.Text(16), got[:16])
+	}
+	return nil
+}
+
+// WaitFor repeats Expect every interval until it succeeds or ctx ends,
+// returning the last mismatch on timeout.
+func WaitFor(ctx context.Context, addr, serverName, fingerprint string, interval time.Duration) error {
+	for {
+		err := Expect(ctx, addr, serverName, fingerprint)
+		if err == nil {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(interval):
+		}
+	}
+}
+
+// Target is an endpoint to check and the SNI to present.
+type Target struct {
+	Addr       string
+	ServerName string
+}
+
+func (t Target) String() string { return t.Addr + "/" + t.ServerName }
+
+// ParseTarget accepts "host", "host:port" or either followed by "/sni". The
+// port defaults to 443 and the SNI to host.
+func ParseTarget(s string) (Target, error) {
+	addr, sni, _ := strings.Cut(strings.TrimSpace(s), "/")
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		host, port = addr, "443"
+	}
+	if host == "" {
+		return Target{}, fmt.Errorf("invalid check target %q", s)
+	}
+	if sni == "" {
+		sni = host
+	}
+	return Target{Addr: net.JoinHostPort(host, port), ServerName: sni}, nil
+}
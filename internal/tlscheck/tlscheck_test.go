@@ -0,0 +1,67 @@
+package tlscheck
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newServer(t *testing.T) (addr, fingerprint string) {
+	srv := httptest.NewTLSServer(http.NotFoundHandler())
+	t.Cleanup(srv.Close)
+	sum := sha256.Sum256(srv.Certificate().Raw)
+	return srv.Listener.Addr().String(), hex.EncodeToString(sum[:])
+}
+
+func TestExpectMatch(t *testing.T) {
+	addr, fingerprint := newServer(t)
+	if err := Expect(context.Background(), addr, "example.com", fingerprint); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := WaitFor(ctx, addr, "example.com", fingerprint, 50*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestWaitForMismatchTimesOut(t *testing.T) {
+	addr, _ := newServer(t)
+	other := strings.Repeat("ab", sha256.Size)
+	ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	err := WaitFor(ctx, addr, "example.com", other, 50*time.Millisecond)
+	if err == nil {
+		t.Fatal("mismatch accepted")
+	}
+	if time.Since(start) < 250*time.Millisecond {
+		t.Errorf("gave up after %s, before the deadline", time.Since(start))
+	}
+	// the last mismatch is reported, not the context error
+	if !strings.Contains(err.Error(), "fingerprint") || !strings.Contains(err.Error(), addr) {
+		t.Errorf("error = %v", err)
+	}
+}
+
+func TestParseTarget(t *testing.T) {
+	for in, want := range map[string]Target{
+		"example.com":                 {"example.com:443", "example.com"},
+		"example.com:8443":            {"example.com:8443", "example.com"},
+		"127.0.0.1/cdn.example.com":   {"127.0.0.1:443", "cdn.example.com"},
+		" [::1]:8443/cdn.example.com": {"[::1]:8443", "cdn.example.com"},
+	} {
+		got, err := ParseTarget(in)
+		if err != nil || got != want {
+			t.Errorf("ParseTarget(%q) = %+v, %v; want %+v", in, got, err, want)
+		}
+	}
+	if _, err := ParseTarget("/sni"); err == nil {
+		t.Error("empty host accepted")
+	}
+}
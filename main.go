@@ -1,91 +1,16 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"os"
-	"strings"
+	"time"
 
-	alidns20150109 "github.com/alibabacloud-go/alidns-20150109/v5/client"
-	openapi "github.com/alibabacloud-go/darabonba-openapi/v2/client"
-	util "github.com/alibabacloud-go/tea-utils/v2/service"
-	"github.com/alibabacloud-go/tea/tea"
+	"auto-https/internal/dns"
+	"auto-https/internal/retry"
 )
 
-func newClient(accessKeyId, accessKeySecret string) (*alidns20150109.Client, error) {
-	cfg := &openapi.Config{
-		AccessKeyId:     tea.String(accessKeyId),
-		AccessKeySecret: tea.String(accessKeySecret),
-	}
-	cfg.Endpoint = tea.String("alidns.cn-hangzhou.aliyuncs.com")
-	return alidns20150109.NewClient(cfg)
-}
-
-func findRecordId(client *alidns20150109.Client, domain, rr, typ string) (string, error) {
-	req := &alidns20150109.DescribeDomainRecordsRequest{
-		DomainName:  tea.String(domain),
-		RRKeyWord:   tea.String(rr),
-		TypeKeyWord: tea.String(typ),
-	}
-	runtime := &util.RuntimeOptions{}
-	resp, err := client.DescribeDomainRecordsWithOptions(req, runtime)
-	if err != nil {
-		return "", err
-	}
-	if resp == nil || resp.Body == nil || resp.Body.DomainRecords == nil || resp.Body.DomainRecords.Record == nil {
-		return "", nil
-	}
-	for _, r := range resp.Body.DomainRecords.Record {
-		// match exact rr and type
-		if strings.EqualFold(tea.StringValue(r.RR), rr) && strings.EqualFold(tea.StringValue(r.Type), typ) {
-			return tea.StringValue(r.RecordId), nil
-		}
-	}
-	return "", nil
-}
-
-func updateRecord(client *alidns20150109.Client, recordId, rr, typ, value string, ttl int64, priority int64, line string) error {
-	req := &alidns20150109.UpdateDomainRecordRequest{
-		RecordId: tea.String(recordId),
-		RR:       tea.String(rr),
-		Type:     tea.String(typ),
-		Value:    tea.String(value),
-	}
-	if ttl > 0 {
-		req.TTL = tea.Int64(ttl)
-	}
-	if priority > 0 {
-		req.Priority = tea.Int64(priority)
-	}
-	if line != "" {
-		req.Line = tea.String(line)
-	}
-	runtime := &util.RuntimeOptions{}
-	_, err := client.UpdateDomainRecordWithOptions(req, runtime)
-	return err
-}
-
-func addRecord(client *alidns20150109.Client, domain, rr, typ, value string, ttl int64, priority int64, line string) error {
-	req := &alidns20150109.AddDomainRecordRequest{
-		DomainName: tea.String(domain),
-		RR:         tea.String(rr),
-		Type:       tea.String(typ),
-		Value:      tea.String(value),
-	}
-	if ttl > 0 {
-		req.TTL = tea.Int64(ttl)
-	}
-	if priority > 0 {
-		req.Priority = tea.Int64(priority)
-	}
-	if line != "" {
-		req.Line = tea.String(line)
-	}
-	runtime := &util.RuntimeOptions{}
-	_, err := client.AddDomainRecordWithOptions(req, runtime)
-	return err
-}
-
 func main() {
 	var (
 		domain          string
@@ -96,6 +21,10 @@ func main() {
 		priority        int
 		line            string
 		createIfMissing bool
+		pageSize        int
+		dryRun          bool
+		timeout         time.Duration
+		retries         int
 	)
 
 	flag.StringVar(&domain, "domain", "", "域名，例如 example.com")
@@ -106,12 +35,24 @@ func main() {
 	flag.IntVar(&priority, "priority", 0, "MX 记录优先级，仅对 MX 有效")
 	flag.StringVar(&line, "line", "default", "解析线路，例如 default")
 	flag.BoolVar(&createIfMissing, "create-if-missing", true, "当记录不存在时自动创建")
+	flag.BoolVar(&dryRun, "dry-run", false, "只打印将要执行的操作，不做任何修改")
+	flag.IntVar(&pageSize, "page-size", dns.AliyunMaxPageSize, "查询解析记录时每页条数，最大 500")
+	flag.DurationVar(&timeout, "timeout", retry.Default.Timeout, "单次 API 调用超时")
+	flag.IntVar(&retries, "retries", retry.Default.Attempts-1, "API 调用失败（限流、5xx、网络错误）后的最大重试次数")
 	flag.Parse()
 
 	if domain == "" || rr == "" || typ == "" || value == "" {
 		fmt.Fprintln(os.Stderr, "参数错误：必须提供 --domain、--rr、--type、--value")
 		os.Exit(2)
 	}
+	if pageSize < 1 || pageSize > dns.AliyunMaxPageSize {
+		fmt.Fprintln(os.Stderr, "参数错误：--page-size 取值范围为 1-500")
+		os.Exit(2)
+	}
+	if retries < 0 || timeout < 0 {
+		fmt.Fprintln(os.Stderr, "参数错误：--retries 与 --timeout 不能为负数")
+		os.Exit(2)
+	}
 
 	ak := os.Getenv("ALICLOUD_ACCESS_KEY_ID")
 	sk := os.Getenv("ALICLOUD_ACCESS_KEY_SECRET")
@@ -120,24 +61,45 @@ func main() {
 		os.Exit(2)
 	}
 
-	client, err := newClient(ak, sk)
+	aliyun, err := dns.NewAliyun(ak, sk)
 	if err != nil {
 		fmt.Fprintln(os.Stderr, "初始化客户端失败：", err)
 		os.Exit(1)
 	}
+	aliyun.PageSize = int64(pageSize)
+	aliyun.Retry.Attempts = retries + 1
+	aliyun.Retry.Timeout = timeout
+	aliyun.Retry.OnRetry = func(op string, attempt int, err error, wait time.Duration) {
+		fmt.Fprintf(os.Stderr, "%s 第 %d 次调用失败，%s 后重试：%v\n", op, attempt, wait.Round(time.Millisecond), err)
+	}
+	var provider dns.Provider = aliyun
+	ctx := context.Background()
 
-	recordId, err := findRecordId(client, domain, rr, typ)
+	existing, err := provider.FindRecord(ctx, domain, rr, typ, "")
 	if err != nil {
 		fmt.Fprintln(os.Stderr, "查询记录失败：", err)
 		os.Exit(1)
 	}
 
-	if recordId == "" {
+	rec := dns.Record{
+		RR:       rr,
+		Type:     typ,
+		Value:    value,
+		TTL:      int64(ttl),
+		Priority: int64(priority),
+		Line:     line,
+	}
+
+	if existing == nil {
 		if !createIfMissing {
 			fmt.Fprintln(os.Stderr, "未找到匹配记录，且未启用自动创建")
 			os.Exit(3)
 		}
-		if err := addRecord(client, domain, rr, typ, value, int64(ttl), int64(priority), line); err != nil {
+		if dryRun {
+			fmt.Printf("[dry-run] 将创建记录 %s %s %s TTL=%d 线路=%s\n", rr+"."+domain, typ, value, ttl, line)
+			return
+		}
+		if _, err := provider.AddRecord(ctx, domain, rec); err != nil {
 			fmt.Fprintln(os.Stderr, "创建记录失败：", err)
 			os.Exit(1)
 		}
@@ -145,7 +107,13 @@ func main() {
 		return
 	}
 
-	if err := updateRecord(client, recordId, rr, typ, value, int64(ttl), int64(priority), line); err != nil {
+	rec.ID = existing.ID
+	if dryRun {
+		fmt.Printf("[dry-run] 将更新记录 %s（RecordId %s）：%s %s → %s %s，TTL %d → %d，线路 %s → %s\n",
+			rr+"."+domain, existing.ID, existing.Type, existing.Value, typ, value, existing.TTL, ttl, existing.Line, line)
+		return
+	}
+	if err := provider.UpdateRecord(ctx, rec); err != nil {
 		fmt.Fprintln(os.Stderr, "更新记录失败：", err)
 		os.Exit(1)
 	}